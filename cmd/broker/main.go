@@ -1,24 +1,35 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"kafka-clone/internal/cluster"
 	"kafka-clone/internal/grpc"
+	"kafka-clone/internal/kafkaproto"
 	"kafka-clone/internal/topics"
 	pb "kafka-clone/proto"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	grpcServer "google.golang.org/grpc"
 )
 
 func main() {
 	var (
-		port    = flag.Int("port", 9092, "gRPC server port")
-		dataDir = flag.String("data-dir", "data", "Data directory for logs")
+		port      = flag.Int("port", 9092, "gRPC server port")
+		dataDir   = flag.String("data-dir", "data", "Data directory for logs")
+		nodeID    = flag.String("node-id", "", "Unique ID for this broker, required when --peers is set")
+		raftPort  = flag.Int("raft-port", 9093, "Raft transport port for this broker")
+		peers     = flag.String("peers", "", "Comma-separated node-id=host:raft-port list of other brokers, e.g. broker-2=10.0.0.2:9093,broker-3=10.0.0.3:9093")
+		bootstrap = flag.Bool("bootstrap", false, "Bootstrap the Raft cluster from this node (run on exactly one node, once)")
+		kafkaPort = flag.Int("kafka-port", 9094, "Native Kafka protocol port, for unmodified Sarama/librdkafka clients")
+		advHost   = flag.String("advertised-host", "localhost", "Host advertised to Kafka clients in Metadata/FindCoordinator responses")
 	)
 	flag.Parse()
 
@@ -29,7 +40,44 @@ func main() {
 
 	// Initialize components
 	registry := topics.NewRegistry(*dataDir)
-	handler := grpc.NewHandler(registry)
+
+	var clus *cluster.Cluster
+	if *peers != "" || *bootstrap {
+		if *nodeID == "" {
+			log.Fatalf("--node-id is required when running as part of a cluster")
+		}
+		peerNodes, err := parsePeers(*peers)
+		if err != nil {
+			log.Fatalf("Failed to parse --peers: %v", err)
+		}
+
+		cfg := cluster.Config{
+			NodeID:       *nodeID,
+			RaftBindAddr: fmt.Sprintf("0.0.0.0:%d", *raftPort),
+			RaftDir:      *dataDir,
+			Peers:        peerNodes,
+			Bootstrap:    *bootstrap,
+		}
+		clus, err = cluster.New(cfg, registry)
+		if err != nil {
+			log.Fatalf("Failed to start cluster: %v", err)
+		}
+	}
+
+	handler := grpc.NewHandler(registry, clus)
+
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	handler.StartGroupReaper(reaperCtx, 5*time.Second)
+
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	startMaintenance(maintenanceCtx, registry, time.Minute)
+
+	var stopISRRefresh context.CancelFunc
+	if clus != nil {
+		var isrCtx context.Context
+		isrCtx, stopISRRefresh = context.WithCancel(context.Background())
+		startISRRefresh(isrCtx, clus, 5*time.Second)
+	}
 
 	// Setup gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
@@ -40,6 +88,17 @@ func main() {
 	s := grpcServer.NewServer()
 	pb.RegisterBrokerServer(s, handler)
 
+	kafkaLis, err := net.Listen("tcp", fmt.Sprintf(":%d", *kafkaPort))
+	if err != nil {
+		log.Fatalf("Failed to listen on kafka port: %v", err)
+	}
+	kafkaSrv := kafkaproto.NewServer(handler.Registry(), handler.Producer(), handler.Consumer(), handler.Coordinator(), *advHost, int32(*kafkaPort))
+	go func() {
+		if err := kafkaSrv.Serve(kafkaLis); err != nil {
+			log.Printf("kafkaproto server stopped: %v", err)
+		}
+	}()
+
 	// Graceful shutdown
 	go func() {
 		sigCh := make(chan os.Signal, 1)
@@ -47,14 +106,79 @@ func main() {
 		<-sigCh
 
 		log.Println("Shutting down...")
+		stopReaper()
+		stopMaintenance()
+		if stopISRRefresh != nil {
+			stopISRRefresh()
+		}
 		s.GracefulStop()
+		kafkaLis.Close()
+		if clus != nil {
+			clus.Shutdown()
+		}
 		registry.Close()
 	}()
 
 	log.Printf("Kafka clone broker starting on port %d", *port)
+	log.Printf("Native Kafka protocol listening on port %d", *kafkaPort)
 	log.Printf("Data directory: %s", *dataDir)
 
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
+
+// startMaintenance periodically runs retention and compaction across every
+// topic this broker hosts locally. It runs until ctx is cancelled.
+func startMaintenance(ctx context.Context, registry *topics.Registry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				registry.RunMaintenance()
+			}
+		}
+	}()
+}
+
+// startISRRefresh periodically recomputes this broker's view of every
+// replicated partition's in-sync-replica set via cluster.RefreshAllISR;
+// without it, registry.SetISR is only ever set
+// once (in cluster.Cluster.AddPartition) and acks=all's min.insync.replicas
+// check never reflects a replica actually falling out of the ISR. It runs
+// until ctx is cancelled.
+func startISRRefresh(ctx context.Context, clus *cluster.Cluster, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				clus.RefreshAllISR()
+			}
+		}
+	}()
+}
+
+// parsePeers parses a comma-separated node-id=host:port list into Nodes.
+func parsePeers(raw string) ([]cluster.Node, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var nodes []cluster.Node
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid peer %q, expected node-id=host:port", entry)
+		}
+		nodes = append(nodes, cluster.Node{ID: parts[0], RaftAddr: parts[1]})
+	}
+	return nodes, nil
+}
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"kafka-clone/internal/logstore"
+	"kafka-clone/internal/topics"
+)
+
+func resolveAddr(bindAddr string) (*net.TCPAddr, error) {
+	addr, err := net.ResolveTCPAddr("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve raft bind address %q: %w", bindAddr, err)
+	}
+	return addr, nil
+}
+
+// Cluster owns one Raft group per partition plus the metadata group used to
+// elect a controller and record which broker replicates which partition.
+// It is the top-level object cmd/broker wires up when --peers or
+// --bootstrap is set; with neither, the broker runs single-node as it
+// always has, and Cluster is simply not created.
+type Cluster struct {
+	cfg        Config
+	registry   *topics.Registry
+	controller *Controller
+
+	mutex      sync.RWMutex
+	partitions map[string]*ReplicatedPartition // "topic/partition" -> replica
+}
+
+// New starts the metadata (controller) Raft group. Partitions are attached
+// lazily via AddPartition as topics are created or discovered, since the
+// set of partitions isn't known until the registry loads them.
+func New(cfg Config, registry *topics.Registry) (*Cluster, error) {
+	controller, err := newController(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("start controller: %w", err)
+	}
+
+	return &Cluster{
+		cfg:        cfg,
+		registry:   registry,
+		controller: controller,
+		partitions: make(map[string]*ReplicatedPartition),
+	}, nil
+}
+
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+// AddPartition starts (or rejoins) the Raft group for a partition and
+// records the broker's intended replica set with the controller, which is
+// the cluster's source of truth for partition leadership and ISR.
+func (c *Cluster) AddPartition(topic string, partitionID int32, part *logstore.Partition, replicas []string) (*ReplicatedPartition, error) {
+	rp, err := NewReplicatedPartition(c.cfg, topic, partitionID, part)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.registry.AttachPartitionLog(topic, partitionID, rp); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.partitions[partitionKey(topic, partitionID)] = rp
+	c.mutex.Unlock()
+
+	if c.controller.IsLeader() {
+		if err := c.controller.AssignReplicas(topic, partitionID, replicas); err != nil {
+			return nil, err
+		}
+	}
+
+	c.RefreshISR(topic, partitionID)
+	return rp, nil
+}
+
+// RefreshISR copies this replica's view of a partition's ISR into the
+// registry, which is what producers.Producer consults for acks=all.
+// cmd/broker refreshes every partition periodically through RefreshAllISR
+// (see its startISRRefresh ticker).
+func (c *Cluster) RefreshISR(topic string, partitionID int32) {
+	rp, ok := c.Partition(topic, partitionID)
+	if !ok {
+		return
+	}
+	c.registry.SetISR(topic, partitionID, rp.ISR())
+}
+
+// RefreshAllISR runs RefreshISR over every partition this broker
+// replicates.
+func (c *Cluster) RefreshAllISR() {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, rp := range c.partitions {
+		c.registry.SetISR(rp.Topic, rp.Partition, rp.ISR())
+	}
+}
+
+// Partition returns the ReplicatedPartition for topic/partitionID, if this
+// broker replicates it.
+func (c *Cluster) Partition(topic string, partitionID int32) (*ReplicatedPartition, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	rp, ok := c.partitions[partitionKey(topic, partitionID)]
+	return rp, ok
+}
+
+// LeaderAndISR reports the current leader and in-sync-replica set for a
+// partition: from this broker's own replica's Raft group if it replicates
+// the partition, otherwise from the controller's recorded assignment.
+func (c *Cluster) LeaderAndISR(topic string, partitionID int32) (leader string, isr []string, err error) {
+	if rp, ok := c.Partition(topic, partitionID); ok {
+		return rp.LeaderID(), rp.ISR(), nil
+	}
+	return c.controller.LeaderAndISR(topic, partitionID)
+}
+
+// Peers returns the node IDs of every broker in the cluster, including this
+// one, suitable as a default replica set for a newly created topic.
+func (c *Cluster) Peers() []string {
+	nodes := c.cfg.allNodes()
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+// IsController reports whether this broker currently leads the metadata
+// Raft group, i.e. whether it is responsible for assigning partition
+// leadership across the cluster.
+func (c *Cluster) IsController() bool {
+	return c.controller.IsLeader()
+}
+
+// Shutdown stops every Raft group this broker participates in.
+func (c *Cluster) Shutdown() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var firstErr error
+	for _, rp := range c.partitions {
+		if err := rp.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := c.controller.Shutdown(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
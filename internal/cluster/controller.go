@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+// Controller is a cluster-wide Raft group whose only job is to record which
+// brokers replicate which partition. Whichever broker leads this group is
+// the controller, mirroring the role Kafka's controller broker plays:
+// deciding replica assignment. Leadership of an individual partition is
+// still decided by that partition's own Raft group (see
+// ReplicatedPartition.LeaderID) rather than by the controller directly,
+// since that is what lets partitions keep serving while the controller
+// itself fails over.
+type Controller struct {
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	fsm       *metadataFSM
+}
+
+type metadataFSM struct {
+	mutex       sync.RWMutex
+	assignments map[string][]string // "topic/partition" -> replica node IDs
+}
+
+type assignCommand struct {
+	Topic     string   `json:"topic"`
+	Partition int32    `json:"partition"`
+	Replicas  []string `json:"replicas"`
+}
+
+func (f *metadataFSM) Apply(entry *raft.Log) interface{} {
+	var cmd assignCommand
+	if err := json.Unmarshal(entry.Data, &cmd); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.assignments[partitionKey(cmd.Topic, cmd.Partition)] = cmd.Replicas
+	return nil
+}
+
+func (f *metadataFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	data, err := json.Marshal(f.assignments)
+	if err != nil {
+		return nil, err
+	}
+	return &metadataSnapshot{data: data}, nil
+}
+
+func (f *metadataFSM) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	var assignments map[string][]string
+	if err := json.NewDecoder(r).Decode(&assignments); err != nil {
+		if err == io.EOF {
+			assignments = make(map[string][]string)
+		} else {
+			return err
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.assignments = assignments
+	return nil
+}
+
+type metadataSnapshot struct {
+	data []byte
+}
+
+func (s *metadataSnapshot) Persist(sink raft.SnapshotSink) error {
+	defer sink.Close()
+	if _, err := sink.Write(s.data); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return nil
+}
+
+func (s *metadataSnapshot) Release() {}
+
+func newController(cfg Config) (*Controller, error) {
+	dir := filepath.Join(cfg.RaftDir, "controller")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	raftCfg := raft.DefaultConfig()
+	raftCfg.LocalID = raft.ServerID(cfg.NodeID)
+
+	addr, err := resolveAddr(cfg.RaftBindAddr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(cfg.RaftBindAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("controller transport: %w", err)
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft-log.bolt"))
+	if err != nil {
+		return nil, fmt.Errorf("controller log store: %w", err)
+	}
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft-stable.bolt"))
+	if err != nil {
+		return nil, fmt.Errorf("controller stable store: %w", err)
+	}
+	snapshotStore, err := raft.NewFileSnapshotStore(dir, 2, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("controller snapshot store: %w", err)
+	}
+
+	fsm := &metadataFSM{assignments: make(map[string][]string)}
+	r, err := raft.NewRaft(raftCfg, fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		return nil, fmt.Errorf("start controller raft: %w", err)
+	}
+
+	if cfg.Bootstrap {
+		servers := make([]raft.Server, 0, len(cfg.allNodes()))
+		for _, n := range cfg.allNodes() {
+			servers = append(servers, raft.Server{ID: raft.ServerID(n.ID), Address: raft.ServerAddress(n.RaftAddr)})
+		}
+		r.BootstrapCluster(raft.Configuration{Servers: servers})
+	}
+
+	return &Controller{raft: r, transport: transport, fsm: fsm}, nil
+}
+
+// AssignReplicas records the replica set for a partition. Only the
+// controller leader can do this; on a follower the Raft apply fails with
+// raft.ErrNotLeader, which is returned as is.
+func (c *Controller) AssignReplicas(topic string, partitionID int32, replicas []string) error {
+	data, err := json.Marshal(assignCommand{Topic: topic, Partition: partitionID, Replicas: replicas})
+	if err != nil {
+		return err
+	}
+	future := c.raft.Apply(data, raftApplyTimeout)
+	return future.Error()
+}
+
+// Replicas returns the last-assigned replica set for a partition.
+func (c *Controller) Replicas(topic string, partitionID int32) []string {
+	c.fsm.mutex.RLock()
+	defer c.fsm.mutex.RUnlock()
+	return c.fsm.assignments[partitionKey(topic, partitionID)]
+}
+
+// LeaderAndISR returns the assigned replica set for a partition as a
+// fallback when this broker doesn't replicate the partition itself (and so
+// has no ReplicatedPartition to ask directly). The first replica in the
+// assignment is treated as the preferred leader.
+func (c *Controller) LeaderAndISR(topic string, partitionID int32) (string, []string, error) {
+	replicas := c.Replicas(topic, partitionID)
+	if len(replicas) == 0 {
+		return "", nil, fmt.Errorf("no replica assignment for partition %s/%d", topic, partitionID)
+	}
+	return replicas[0], replicas, nil
+}
+
+// IsLeader reports whether this broker is the current controller.
+func (c *Controller) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+func (c *Controller) Shutdown() error {
+	if err := c.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	return c.transport.Close()
+}
@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"kafka-clone/internal/logstore"
+
+	"github.com/hashicorp/raft"
+)
+
+// partitionFSM applies committed Raft log entries to the partition's local
+// segment files. The segments themselves remain the on-disk state; Raft
+// only orders the writes across replicas and decides what is committed.
+type partitionFSM struct {
+	partition *logstore.Partition
+}
+
+// applyResult is what Apply returns through raft.ApplyFuture.Response().
+type applyResult struct {
+	offset int64
+	err    error
+}
+
+func (f *partitionFSM) Apply(entry *raft.Log) interface{} {
+	key, payload, err := decodeAppend(entry.Data)
+	if err != nil {
+		return applyResult{err: err}
+	}
+	offset, err := f.partition.Append(key, payload)
+	return applyResult{offset: offset, err: err}
+}
+
+// encodeAppend packs a key and payload into the single byte slice Raft
+// replicates as a log entry, as [keyLen uint32 BE][key][payload].
+func encodeAppend(key, payload []byte) []byte {
+	buf := make([]byte, 0, 4+len(key)+len(payload))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+	buf = append(buf, key...)
+	buf = append(buf, payload...)
+	return buf
+}
+
+// decodeAppend reverses encodeAppend.
+func decodeAppend(data []byte) (key, payload []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("raft log entry too short")
+	}
+	keyLen := binary.BigEndian.Uint32(data[:4])
+	data = data[4:]
+	if uint32(len(data)) < keyLen {
+		return nil, nil, fmt.Errorf("raft log entry truncated key")
+	}
+	return data[:keyLen], data[keyLen:], nil
+}
+
+// partitionSnapshot carries every record currently in the partition's
+// segment files, so that a replica installing this snapshot (a newly added
+// node, or one that fell behind past Raft's trailing logs) ends up with the
+// actual data rather than just believing it's caught up. Format is an
+// 8-byte nextOffset header followed by each record as
+// [offset int64 BE][keyLen uint32 BE][key][payloadLen uint32 BE][payload],
+// in ascending offset order, to EOF.
+type partitionSnapshot struct {
+	entries    []logstore.LogEntry
+	nextOffset int64
+}
+
+func (s *partitionSnapshot) Persist(sink raft.SnapshotSink) error {
+	defer sink.Close()
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint64(header, uint64(s.nextOffset))
+	if _, err := sink.Write(header); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	for _, entry := range s.entries {
+		if err := writeSnapshotEntry(sink, entry); err != nil {
+			sink.Cancel()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *partitionSnapshot) Release() {}
+
+// writeSnapshotEntry writes entry in partitionSnapshot's on-disk format.
+func writeSnapshotEntry(w io.Writer, entry logstore.LogEntry) error {
+	buf := make([]byte, 0, 16+len(entry.Key)+len(entry.Payload))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(entry.Offset))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Key)))
+	buf = append(buf, entry.Key...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Payload)))
+	buf = append(buf, entry.Payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readSnapshotEntry reverses writeSnapshotEntry, returning io.EOF
+// (unwrapped) exactly when the stream ends cleanly between entries.
+func readSnapshotEntry(r io.Reader) (logstore.LogEntry, error) {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return logstore.LogEntry{}, err
+	}
+	offset := int64(binary.BigEndian.Uint64(head))
+
+	keyLen, err := readUint32(r)
+	if err != nil {
+		return logstore.LogEntry{}, fmt.Errorf("read snapshot entry key length: %w", err)
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return logstore.LogEntry{}, fmt.Errorf("read snapshot entry key: %w", err)
+	}
+
+	payloadLen, err := readUint32(r)
+	if err != nil {
+		return logstore.LogEntry{}, fmt.Errorf("read snapshot entry payload length: %w", err)
+	}
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return logstore.LogEntry{}, fmt.Errorf("read snapshot entry payload: %w", err)
+	}
+
+	return logstore.LogEntry{Offset: offset, Key: key, Payload: payload}, nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
+
+// Snapshot captures every record currently on this replica's local
+// segments. It runs concurrently with Apply on the leader, but FSMSnapshot
+// is documented to be safe to build from a consistent point-in-time view
+// once Snapshot returns, which ForEach's single pass over the segment files
+// provides.
+func (f *partitionFSM) Snapshot() (raft.FSMSnapshot, error) {
+	var entries []logstore.LogEntry
+	if err := f.partition.ForEach(func(entry *logstore.LogEntry) error {
+		entries = append(entries, *entry)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("scan partition for snapshot: %w", err)
+	}
+	return &partitionSnapshot{entries: entries, nextOffset: f.partition.NextOffset()}, nil
+}
+
+// Restore replaces this replica's local segment files with the records
+// carried by the snapshot, then advances the partition to the snapshotted
+// nextOffset. Raft only calls this when installing a snapshot from another
+// node (a newly added replica, or one that fell too far behind), so it's
+// correct to discard whatever is on disk locally first - the snapshot is
+// the authoritative state at that point in the log.
+func (f *partitionFSM) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("read snapshot header: %w", err)
+	}
+	nextOffset := int64(binary.BigEndian.Uint64(header))
+
+	var entries []logstore.LogEntry
+	for {
+		entry, err := readSnapshotEntry(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return f.partition.RestoreFrom(entries, nextOffset)
+}
@@ -0,0 +1,34 @@
+package cluster
+
+// Node describes a broker participating in the Raft-replicated cluster.
+type Node struct {
+	ID       string
+	RaftAddr string
+}
+
+// Config controls how this broker joins the cluster.
+type Config struct {
+	// NodeID must be unique across the cluster and stable across restarts;
+	// it doubles as the Raft server ID for every partition this broker
+	// replicates.
+	NodeID string
+	// RaftBindAddr is the host:port this broker's Raft transport listens on.
+	RaftBindAddr string
+	// RaftDir is where per-partition Raft logs and snapshots are stored.
+	RaftDir string
+	// Peers lists every other broker in the cluster, used for the initial
+	// bootstrap of each partition's Raft group and the metadata group.
+	Peers []Node
+	// Bootstrap is true on the node that performs first-time cluster
+	// bootstrap (normally the operator picks exactly one node for this).
+	Bootstrap bool
+}
+
+func (c Config) self() Node {
+	return Node{ID: c.NodeID, RaftAddr: c.RaftBindAddr}
+}
+
+func (c Config) allNodes() []Node {
+	nodes := append([]Node{c.self()}, c.Peers...)
+	return nodes
+}
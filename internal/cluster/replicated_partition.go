@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"kafka-clone/internal/logstore"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+const raftApplyTimeout = 10 * time.Second
+
+// ReplicatedPartition turns a single logstore.Partition into a Raft-backed
+// replicated log: Append only succeeds on the leader and blocks until a
+// majority of replicas have durably stored the entry, while Read is served
+// directly from this node's local segments regardless of leadership so
+// read_replica consumers can fan out across followers.
+type ReplicatedPartition struct {
+	Topic     string
+	Partition int32
+
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	partition *logstore.Partition
+}
+
+// NewReplicatedPartition starts (or rejoins) the Raft group backing a
+// single partition. Raft's log/stable/snapshot stores live in
+// cfg.RaftDir/<topic>/partition<N>; when RaftDir is the broker's data
+// directory (as cmd/broker sets it), that is the same directory as the
+// partition's logstore segment files.
+func NewReplicatedPartition(cfg Config, topic string, partitionID int32, part *logstore.Partition) (*ReplicatedPartition, error) {
+	raftDir := filepath.Join(cfg.RaftDir, topic, fmt.Sprintf("partition%d", partitionID))
+	if err := os.MkdirAll(raftDir, 0755); err != nil {
+		return nil, err
+	}
+
+	raftCfg := raft.DefaultConfig()
+	raftCfg.LocalID = raft.ServerID(cfg.NodeID)
+
+	addr, err := resolveAddr(cfg.RaftBindAddr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(cfg.RaftBindAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("partition %s/%d: raft transport: %w", topic, partitionID, err)
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(raftDir, "raft-log.bolt"))
+	if err != nil {
+		return nil, fmt.Errorf("partition %s/%d: raft log store: %w", topic, partitionID, err)
+	}
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(raftDir, "raft-stable.bolt"))
+	if err != nil {
+		return nil, fmt.Errorf("partition %s/%d: raft stable store: %w", topic, partitionID, err)
+	}
+	snapshotStore, err := raft.NewFileSnapshotStore(raftDir, 2, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("partition %s/%d: raft snapshot store: %w", topic, partitionID, err)
+	}
+
+	fsm := &partitionFSM{partition: part}
+	r, err := raft.NewRaft(raftCfg, fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		return nil, fmt.Errorf("partition %s/%d: start raft: %w", topic, partitionID, err)
+	}
+
+	if cfg.Bootstrap {
+		servers := make([]raft.Server, 0, len(cfg.allNodes()))
+		for _, n := range cfg.allNodes() {
+			servers = append(servers, raft.Server{ID: raft.ServerID(n.ID), Address: raft.ServerAddress(n.RaftAddr)})
+		}
+		r.BootstrapCluster(raft.Configuration{Servers: servers})
+	}
+
+	return &ReplicatedPartition{
+		Topic:     topic,
+		Partition: partitionID,
+		raft:      r,
+		transport: transport,
+		partition: part,
+	}, nil
+}
+
+// Append replicates key and payload through Raft and returns the offset it
+// was assigned once a majority of replicas have committed it. It returns
+// raft.ErrNotLeader (wrapped) if called on a follower; callers should route
+// the produce request to the current leader instead, e.g. via Metadata.
+func (p *ReplicatedPartition) Append(key, payload []byte) (int64, error) {
+	future := p.raft.Apply(encodeAppend(key, payload), raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return 0, fmt.Errorf("replicate to partition %s/%d: %w", p.Topic, p.Partition, err)
+	}
+
+	result, ok := future.Response().(applyResult)
+	if !ok {
+		return 0, fmt.Errorf("unexpected apply response for partition %s/%d", p.Topic, p.Partition)
+	}
+	return result.offset, result.err
+}
+
+// Read serves directly from this node's local segments; it works on
+// followers as well as the leader, since every replica applies the same
+// committed entries in the same order.
+func (p *ReplicatedPartition) Read(offset int64) (*logstore.LogEntry, error) {
+	return p.partition.Read(offset)
+}
+
+// NextOffset returns the next offset this partition will assign, read
+// locally same as Read.
+func (p *ReplicatedPartition) NextOffset() int64 {
+	return p.partition.NextOffset()
+}
+
+// ReadBatch serves directly from this node's local segments, same as Read:
+// decoding an already-committed batch needs no consensus, so this works on
+// followers too. It satisfies topics' batchReader interface, but
+// ReplicatedPartition deliberately does not implement AppendBatch - batching
+// a produce would mean replicating a new kind of Raft log entry, which
+// partitionFSM doesn't decode yet. Until that lands, ProduceBatch fails for
+// replicated topics (see topics.Registry.AppendBatch) while ReadBatch,
+// ReadInto and RecordSetLen below all work, since Kafka's Fetch path only
+// ever reads.
+func (p *ReplicatedPartition) ReadBatch(offset int64) (*logstore.RecordBatch, error) {
+	return p.partition.ReadBatch(offset)
+}
+
+// ReadInto streams raw on-disk bytes directly from this node's local
+// segments, the zero-copy counterpart to ReadBatch; see its doc comment for
+// why this is safe to serve without consensus while AppendBatch is not.
+func (p *ReplicatedPartition) ReadInto(w io.Writer, offset, maxBytes int64) (int64, error) {
+	return p.partition.ReadInto(w, offset, maxBytes)
+}
+
+// RecordSetLen resolves the byte length ReadInto would stream, without
+// transferring anything; see ReadBatch's doc comment.
+func (p *ReplicatedPartition) RecordSetLen(offset, maxBytes int64) (int64, error) {
+	return p.partition.RecordSetLen(offset, maxBytes)
+}
+
+// IsLeader reports whether this replica is the current partition leader.
+func (p *ReplicatedPartition) IsLeader() bool {
+	return p.raft.State() == raft.Leader
+}
+
+// LeaderID returns the node ID of the current partition leader, or "" if
+// none is known yet.
+func (p *ReplicatedPartition) LeaderID() string {
+	_, id := p.raft.LeaderWithID()
+	return string(id)
+}
+
+// ISR returns the node IDs Raft currently considers part of the
+// configuration for this partition. It is an approximation of Kafka's ISR:
+// Raft does not distinguish "in sync" from "configured", so a replica that
+// is merely slow to replicate (but still a voter) is still reported here.
+func (p *ReplicatedPartition) ISR() []string {
+	future := p.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(future.Configuration().Servers))
+	for _, s := range future.Configuration().Servers {
+		ids = append(ids, string(s.ID))
+	}
+	return ids
+}
+
+// ApplyRetention runs local retention on this replica's segments. Every
+// replica applies retention independently; since all replicas received the
+// same committed entries in the same order, they converge on the same
+// surviving segments.
+func (p *ReplicatedPartition) ApplyRetention() error {
+	return p.partition.ApplyRetention()
+}
+
+// Compact runs local log compaction on this replica's segments, the same
+// way ApplyRetention does.
+func (p *ReplicatedPartition) Compact() error {
+	return p.partition.Compact()
+}
+
+// Close stops this replica's Raft participation, closes its transport, and
+// finally closes the underlying local partition segments, satisfying
+// topics.PartitionLog.
+func (p *ReplicatedPartition) Close() error {
+	if err := p.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	if err := p.transport.Close(); err != nil {
+		return err
+	}
+	return p.partition.Close()
+}
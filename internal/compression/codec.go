@@ -0,0 +1,146 @@
+// Package compression implements the record-batch compression codecs
+// producers can choose between, mirroring Kafka's own compression.type
+// values.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec identifies which compression algorithm a RecordBatch's records are
+// compressed with.
+type Codec byte
+
+const (
+	None Codec = iota
+	Gzip
+	Snappy
+	LZ4
+	Zstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Snappy:
+		return "snappy"
+	case LZ4:
+		return "lz4"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+// Encoding compresses and decompresses a batch's concatenated records as a
+// single unit.
+type Encoding interface {
+	Encode(src []byte) ([]byte, error)
+	Decode(src []byte) ([]byte, error)
+}
+
+// Get returns the Encoding for c, or an error if c isn't recognized.
+func Get(c Codec) (Encoding, error) {
+	switch c {
+	case None:
+		return noneEncoding{}, nil
+	case Gzip:
+		return gzipEncoding{}, nil
+	case Snappy:
+		return snappyEncoding{}, nil
+	case LZ4:
+		return lz4Encoding{}, nil
+	case Zstd:
+		return zstdEncoding{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", byte(c))
+	}
+}
+
+type noneEncoding struct{}
+
+func (noneEncoding) Encode(src []byte) ([]byte, error) { return src, nil }
+func (noneEncoding) Decode(src []byte) ([]byte, error) { return src, nil }
+
+type gzipEncoding struct{}
+
+func (gzipEncoding) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipEncoding) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type snappyEncoding struct{}
+
+func (snappyEncoding) Encode(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyEncoding) Decode(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
+
+type lz4Encoding struct{}
+
+func (lz4Encoding) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (lz4Encoding) Decode(src []byte) ([]byte, error) {
+	r := lz4.NewReader(bytes.NewReader(src))
+	return io.ReadAll(r)
+}
+
+type zstdEncoding struct{}
+
+func (zstdEncoding) Encode(src []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(src, nil), nil
+}
+
+func (zstdEncoding) Decode(src []byte) ([]byte, error) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return dec.DecodeAll(src, nil)
+}
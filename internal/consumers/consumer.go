@@ -1,6 +1,7 @@
 package consumers
 
 import (
+	"fmt"
 	"kafka-clone/internal/logstore"
 	"kafka-clone/internal/topics"
 	"sync"
@@ -45,6 +46,58 @@ func (c *Consumer) Consume(topic string, partition int32, offset int64) (*logsto
 	return entry, nil
 }
 
+// ConsumeBatch returns whole record batches starting at offset, bounded by
+// maxBytes of total record data, mirroring Kafka's fetch.max.bytes. It
+// never splits a batch to stay under the limit, so it always returns at
+// least one batch if one is available, even if that batch alone exceeds
+// maxBytes.
+func (c *Consumer) ConsumeBatch(topic string, partition int32, offset int64, maxBytes int64) ([]*logstore.RecordBatch, error) {
+	part, err := c.registry.GetPartition(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []*logstore.RecordBatch
+	var total int64
+	current := offset
+	for current < part.NextOffset() {
+		batch, err := c.registry.ReadBatch(topic, partition, current)
+		if err != nil {
+			break
+		}
+
+		size := batchByteSize(batch)
+		if len(batches) > 0 && total+size > maxBytes {
+			break
+		}
+
+		batches = append(batches, batch)
+		total += size
+		current = batch.BaseOffset + int64(len(batch.Records))
+
+		if total >= maxBytes {
+			break
+		}
+	}
+
+	if len(batches) > 0 {
+		key := c.offsetKey(topic, partition)
+		c.mutex.Lock()
+		c.offsets[key] = current
+		c.mutex.Unlock()
+	}
+
+	return batches, nil
+}
+
+func batchByteSize(batch *logstore.RecordBatch) int64 {
+	var size int64
+	for _, rec := range batch.Records {
+		size += int64(len(rec.Key) + len(rec.Payload))
+	}
+	return size
+}
+
 func (c *Consumer) GetOffset(topic string, partition int32) int64 {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -53,6 +106,14 @@ func (c *Consumer) GetOffset(topic string, partition int32) int64 {
 	return c.offsets[key]
 }
 
+// offsetKey must be collision-free across topics: two different (topic,
+// partition) pairs can never produce the same key. Concatenating
+// string(rune(partition)) doesn't hold that property — it encodes
+// partition as a single Unicode code point, so it collides across topic
+// boundaries (e.g. topic "foo" partition 111 produces the same key as
+// topic "foo:o" partition 0) and truncates/mangles partitions above the
+// Basic Multilingual Plane. fmt.Sprintf with a literal separator and a
+// decimal partition number can't alias like that.
 func (c *Consumer) offsetKey(topic string, partition int32) string {
-	return topic + ":" + string(rune(partition))
+	return fmt.Sprintf("%s:%d", topic, partition)
 }
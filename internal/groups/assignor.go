@@ -0,0 +1,227 @@
+package groups
+
+import "sort"
+
+// Assignor computes a partition assignment for the members of a group.
+//
+// partitionsPerTopic gives the partition count of every topic subscribed to
+// by at least one member. Each member's Assignment field holds the
+// partitions it owned going into the rebalance (empty on a group's first
+// rebalance) and is only consulted by assignors that try to minimize
+// movement.
+type Assignor interface {
+	Name() string
+	Assign(members []*Member, partitionsPerTopic map[string]int32) map[string][]TopicPartition
+}
+
+// sortedMemberIDs returns member IDs in a stable order so that assignment is
+// deterministic across brokers computing it independently.
+func sortedMemberIDs(members []*Member) []string {
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// topicPartitions expands a topic's partition count into a sorted list of
+// TopicPartition values.
+func topicPartitions(topic string, count int32) []TopicPartition {
+	parts := make([]TopicPartition, count)
+	for i := int32(0); i < count; i++ {
+		parts[i] = TopicPartition{Topic: topic, Partition: i}
+	}
+	return parts
+}
+
+// subscribedTopics returns the sorted union of topics subscribed to across
+// all members, so that copartitioned topics (equal partition counts) are
+// always walked in the same order.
+func subscribedTopics(members []*Member) []string {
+	seen := make(map[string]bool)
+	var topics []string
+	for _, m := range members {
+		for _, t := range m.Topics {
+			if !seen[t] {
+				seen[t] = true
+				topics = append(topics, t)
+			}
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// RangeAssignor assigns each topic's partitions as a contiguous range per
+// member, one topic at a time. This mirrors Kafka's default "range"
+// strategy: it is simple but can leave partitions unevenly spread when
+// members subscribe to different sets of topics.
+type RangeAssignor struct{}
+
+func (RangeAssignor) Name() string { return "range" }
+
+func (RangeAssignor) Assign(members []*Member, partitionsPerTopic map[string]int32) map[string][]TopicPartition {
+	assignment := make(map[string][]TopicPartition, len(members))
+	for _, topic := range subscribedTopics(members) {
+		subscribers := membersSubscribedTo(members, topic)
+		if len(subscribers) == 0 {
+			continue
+		}
+		partitions := topicPartitions(topic, partitionsPerTopic[topic])
+		numPartitionsPerMember := len(partitions) / len(subscribers)
+		extra := len(partitions) % len(subscribers)
+
+		start := 0
+		for i, id := range subscribers {
+			count := numPartitionsPerMember
+			if i < extra {
+				count++
+			}
+			assignment[id] = append(assignment[id], partitions[start:start+count]...)
+			start += count
+		}
+	}
+	return assignment
+}
+
+// RoundRobinAssignor lays every subscribed topic's partitions out in a
+// single sorted sequence and deals them to members round-robin.
+type RoundRobinAssignor struct{}
+
+func (RoundRobinAssignor) Name() string { return "roundrobin" }
+
+func (RoundRobinAssignor) Assign(members []*Member, partitionsPerTopic map[string]int32) map[string][]TopicPartition {
+	assignment := make(map[string][]TopicPartition, len(members))
+	ids := sortedMemberIDs(members)
+	if len(ids) == 0 {
+		return assignment
+	}
+
+	i := 0
+	for _, topic := range subscribedTopics(members) {
+		subscribers := membersSubscribedTo(members, topic)
+		if len(subscribers) == 0 {
+			continue
+		}
+		eligible := make(map[string]bool, len(subscribers))
+		for _, id := range subscribers {
+			eligible[id] = true
+		}
+
+		for _, tp := range topicPartitions(topic, partitionsPerTopic[topic]) {
+			// Advance to the next eligible member in round-robin order.
+			for !eligible[ids[i%len(ids)]] {
+				i++
+			}
+			id := ids[i%len(ids)]
+			assignment[id] = append(assignment[id], tp)
+			i++
+		}
+	}
+	return assignment
+}
+
+func membersSubscribedTo(members []*Member, topic string) []string {
+	var ids []string
+	for _, m := range members {
+		for _, t := range m.Topics {
+			if t == topic {
+				ids = append(ids, m.ID)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// StickyAssignor implements cooperative-sticky assignment: it tries to
+// preserve each member's previous assignment so that a rebalance only moves
+// the minimum number of partitions necessary to balance the group, which is
+// what lets a cooperative consumer keep processing the partitions it isn't
+// losing instead of stopping the world on every rebalance.
+//
+// Assignment happens in two conceptual phases mirroring Kafka's
+// cooperative-sticky protocol: first, partitions that are no longer valid
+// (the topic lost partitions, or the owner is no longer subscribed) are
+// revoked; second, the remaining unassigned partitions are handed out to
+// the least-loaded members. Copartitioned topics (equal partition counts,
+// subscribed to by the same members) end up with identical per-member
+// assignments because partitions are walked in the same sorted topic order
+// for every member.
+type StickyAssignor struct{}
+
+func (StickyAssignor) Name() string { return "sticky" }
+
+func (StickyAssignor) Assign(members []*Member, partitionsPerTopic map[string]int32) map[string][]TopicPartition {
+	assignment := make(map[string][]TopicPartition, len(members))
+	for _, m := range members {
+		assignment[m.ID] = nil
+	}
+
+	// Phase 1 walks members sorted by ID rather than in caller order (which
+	// is whatever order the coordinator's member map iterated in), so that
+	// a tie between two stale claims on the same partition always resolves
+	// to the same member regardless of map iteration order - see the
+	// "first claimant wins" comment below.
+	sorted := make([]*Member, len(members))
+	copy(sorted, members)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	// Phase 1: revoke. Keep a prior partition only if its topic is still
+	// valid, still within the current partition count, and the owner is
+	// still subscribed to it.
+	owned := make(map[TopicPartition]string)
+	for _, m := range sorted {
+		subscribed := make(map[string]bool, len(m.Topics))
+		for _, t := range m.Topics {
+			subscribed[t] = true
+		}
+		for _, tp := range m.Assignment {
+			if !subscribed[tp.Topic] {
+				continue
+			}
+			if tp.Partition >= partitionsPerTopic[tp.Topic] {
+				continue
+			}
+			if _, taken := owned[tp]; taken {
+				// Another member also claims this partition from a stale
+				// assignment; first claimant (sorted by member ID) wins.
+				continue
+			}
+			owned[tp] = m.ID
+			assignment[m.ID] = append(assignment[m.ID], tp)
+		}
+	}
+
+	// Phase 2: assign the remaining partitions to whichever eligible member
+	// currently holds the fewest, breaking ties by member ID so the result
+	// is deterministic.
+	for _, topic := range subscribedTopics(members) {
+		subscribers := membersSubscribedTo(members, topic)
+		if len(subscribers) == 0 {
+			continue
+		}
+		for _, tp := range topicPartitions(topic, partitionsPerTopic[topic]) {
+			if _, taken := owned[tp]; taken {
+				continue
+			}
+			target := leastLoaded(subscribers, assignment)
+			assignment[target] = append(assignment[target], tp)
+			owned[tp] = target
+		}
+	}
+
+	return assignment
+}
+
+func leastLoaded(candidates []string, assignment map[string][]TopicPartition) string {
+	best := candidates[0]
+	for _, id := range candidates[1:] {
+		if len(assignment[id]) < len(assignment[best]) {
+			best = id
+		}
+	}
+	return best
+}
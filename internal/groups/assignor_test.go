@@ -0,0 +1,28 @@
+package groups
+
+import "testing"
+
+// TestStickyAssignorPhase1DeterministicRegardlessOfOrder guards against
+// regressing to resolving conflicting stale claims in caller order (which
+// computeAssignment fed in straight from map iteration): two members with
+// overlapping stale claims on the same partition must agree on the same
+// winner no matter what order they're passed in, since every broker
+// computing the assignment independently must reach the same result.
+func TestStickyAssignorPhase1DeterministicRegardlessOfOrder(t *testing.T) {
+	partitionsPerTopic := map[string]int32{"t": 1}
+	tp := TopicPartition{Topic: "t", Partition: 0}
+
+	memberA := &Member{ID: "a", Topics: []string{"t"}, Assignment: []TopicPartition{tp}}
+	memberB := &Member{ID: "b", Topics: []string{"t"}, Assignment: []TopicPartition{tp}}
+
+	forward := StickyAssignor{}.Assign([]*Member{memberA, memberB}, partitionsPerTopic)
+	backward := StickyAssignor{}.Assign([]*Member{memberB, memberA}, partitionsPerTopic)
+
+	if len(forward["a"]) != len(backward["a"]) || len(forward["b"]) != len(backward["b"]) {
+		t.Fatalf("assignment depends on input order: forward=%v backward=%v", forward, backward)
+	}
+	// The lower member ID ("a") must win the stale claim both times.
+	if len(forward["a"]) != 1 || len(forward["b"]) != 0 {
+		t.Fatalf("want member a to win the stale claim, got forward=%v", forward)
+	}
+}
@@ -0,0 +1,347 @@
+package groups
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"kafka-clone/internal/offsets"
+)
+
+// state is the lifecycle of a consumer group, mirroring Kafka's group
+// states closely enough to drive JoinGroup/SyncGroup/Heartbeat.
+type state int
+
+const (
+	stateEmpty state = iota
+	statePreparingRebalance
+	stateCompletingRebalance
+	stateStable
+	stateDead
+)
+
+// Group is a single consumer group tracked by the Coordinator.
+type Group struct {
+	ID          string
+	Generation  int32
+	State       state
+	Assignor    string
+	LeaderID    string
+	Members     map[string]*Member
+	Assignments map[string][]TopicPartition
+	// nextMemberSeq generates the numeric suffix for auto-assigned member
+	// IDs. It only ever increases, unlike len(Members), which shrinks on
+	// LeaveGroup/ReapExpiredMembers - using the map size would let two
+	// members get the same generated ID after any join/leave churn.
+	nextMemberSeq int32
+}
+
+var assignors = map[string]Assignor{
+	"range":      RangeAssignor{},
+	"roundrobin": RoundRobinAssignor{},
+	"sticky":     StickyAssignor{},
+}
+
+// Coordinator tracks group membership and offsets for every consumer group
+// on this broker. A production cluster shards groups across brokers by
+// hashing the group ID to a partition of __consumer_offsets and electing
+// that partition's leader as coordinator; this implementation coordinates
+// every group locally, which is correct for a single broker and is the
+// seam where that sharding would later be introduced.
+type Coordinator struct {
+	mutex      sync.Mutex
+	groups     map[string]*Group
+	partitions map[string]int32 // topic -> partition count, refreshed by the caller via SetPartitionCount
+	offsets    *offsets.Store
+}
+
+// NewCoordinator creates a Coordinator backed by log, the durable
+// __consumer_offsets store offset commits are persisted to (see
+// offsets.NewConsumerOffsetsLog). It starts with no known partition counts;
+// callers supply them via SetPartitionCount as topics are created.
+func NewCoordinator(log offsets.Log) *Coordinator {
+	return &Coordinator{
+		groups:     make(map[string]*Group),
+		partitions: make(map[string]int32),
+		offsets:    offsets.New(log),
+	}
+}
+
+// SetPartitionCount records the current partition count for topic, so that
+// subsequent rebalances assign the right number of partitions.
+func (c *Coordinator) SetPartitionCount(topic string, count int32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.partitions[topic] = count
+}
+
+func (c *Coordinator) group(groupID string) *Group {
+	g, ok := c.groups[groupID]
+	if !ok {
+		g = &Group{
+			ID:      groupID,
+			State:   stateEmpty,
+			Members: make(map[string]*Member),
+		}
+		c.groups[groupID] = g
+	}
+	return g
+}
+
+// JoinGroup adds or refreshes a member, bumps the group's generation, and
+// moves the group straight to CompletingRebalance, so the returned
+// generation/leader/members are final and the leader can compute an
+// assignment via SyncGroup right away.
+func (c *Coordinator) JoinGroup(req JoinRequest) (JoinResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	g := c.group(req.GroupID)
+	if g.State == stateDead {
+		return JoinResult{}, fmt.Errorf("group %s is dead", req.GroupID)
+	}
+
+	memberID := req.MemberID
+	if memberID == "" {
+		g.nextMemberSeq++
+		memberID = fmt.Sprintf("%s-%d", req.ClientID, g.nextMemberSeq)
+	}
+
+	assignor := req.Assignor
+	if assignor == "" {
+		assignor = "sticky"
+	}
+	if _, ok := assignors[assignor]; !ok {
+		return JoinResult{}, fmt.Errorf("unknown assignor %q", assignor)
+	}
+
+	existing, rejoining := g.Members[memberID]
+	m := &Member{
+		ID:               memberID,
+		ClientID:         req.ClientID,
+		Topics:           req.Topics,
+		SessionTimeout:   req.SessionTimeout,
+		RebalanceTimeout: req.RebalanceTimeout,
+		Assignor:         assignor,
+		LastHeartbeat:    time.Now(),
+	}
+	if rejoining {
+		// Preserve the member's last assignment so the sticky assignor can
+		// try to keep it in place.
+		m.Assignment = existing.Assignment
+	}
+	g.Members[memberID] = m
+	g.Assignor = assignor
+
+	if g.State != statePreparingRebalance {
+		g.State = statePreparingRebalance
+		g.Generation++
+	}
+
+	if g.LeaderID == "" {
+		g.LeaderID = memberID
+	}
+
+	// With no real wire-level rebalance delay to batch joins, a group
+	// becomes ready to sync as soon as it has at least one member. The
+	// RebalanceTimeout a member requests is recorded but not enforced:
+	// members are only ever removed by LeaveGroup or by missing their
+	// SessionTimeout (see ReapExpiredMembers).
+	g.State = stateCompletingRebalance
+
+	memberIDs := make([]string, 0, len(g.Members))
+	for id := range g.Members {
+		memberIDs = append(memberIDs, id)
+	}
+
+	return JoinResult{
+		GenerationID: g.Generation,
+		Assignor:     assignor,
+		MemberID:     memberID,
+		LeaderID:     g.LeaderID,
+		MemberIDs:    memberIDs,
+	}, nil
+}
+
+// SyncGroup supplies the computed assignment (only meaningful from the
+// group leader; followers pass a nil assignments map) and returns the
+// partitions assigned to the calling member.
+func (c *Coordinator) SyncGroup(groupID, memberID string, generation int32, assignments map[string][]TopicPartition) ([]TopicPartition, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	g, ok := c.groups[groupID]
+	if !ok {
+		return nil, fmt.Errorf("group %s not found", groupID)
+	}
+	if generation != g.Generation {
+		return nil, fmt.Errorf("generation %d is stale, current is %d", generation, g.Generation)
+	}
+	if _, ok := g.Members[memberID]; !ok {
+		return nil, fmt.Errorf("member %s is not part of group %s", memberID, groupID)
+	}
+
+	if memberID == g.LeaderID {
+		if assignments == nil {
+			assignments = c.computeAssignment(g)
+		}
+		g.Assignments = assignments
+		for id, parts := range assignments {
+			if m, ok := g.Members[id]; ok {
+				m.Assignment = parts
+			}
+		}
+		g.State = stateStable
+	}
+
+	if g.State != stateStable {
+		return nil, fmt.Errorf("group %s has not completed its rebalance yet", groupID)
+	}
+
+	return g.Assignments[memberID], nil
+}
+
+// computeAssignment runs the group's chosen assignor over its current
+// members, restricted to topics whose partition counts are known.
+func (c *Coordinator) computeAssignment(g *Group) map[string][]TopicPartition {
+	assignor := assignors[g.Assignor]
+
+	members := make([]*Member, 0, len(g.Members))
+	for _, m := range g.Members {
+		members = append(members, m)
+	}
+
+	partitionCounts := make(map[string]int32)
+	for _, m := range members {
+		for _, t := range m.Topics {
+			if count, ok := c.partitions[t]; ok {
+				partitionCounts[t] = count
+			}
+		}
+	}
+
+	return assignor.Assign(members, partitionCounts)
+}
+
+// Heartbeat refreshes a member's session and reports whether a rebalance is
+// in progress, in which case the member should rejoin.
+func (c *Coordinator) Heartbeat(groupID, memberID string, generation int32) (rebalancing bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	g, ok := c.groups[groupID]
+	if !ok {
+		return false, fmt.Errorf("group %s not found", groupID)
+	}
+	m, ok := g.Members[memberID]
+	if !ok {
+		return false, fmt.Errorf("member %s is not part of group %s", memberID, groupID)
+	}
+	if generation != g.Generation {
+		return false, fmt.Errorf("generation %d is stale, current is %d", generation, g.Generation)
+	}
+
+	m.LastHeartbeat = time.Now()
+	return g.State != stateStable, nil
+}
+
+// LeaveGroup removes a member immediately, forcing a rebalance of whatever
+// members remain.
+func (c *Coordinator) LeaveGroup(groupID, memberID string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	g, ok := c.groups[groupID]
+	if !ok {
+		return fmt.Errorf("group %s not found", groupID)
+	}
+	delete(g.Members, memberID)
+
+	if len(g.Members) == 0 {
+		g.State = stateEmpty
+		g.LeaderID = ""
+		return nil
+	}
+
+	if g.LeaderID == memberID {
+		for id := range g.Members {
+			g.LeaderID = id
+			break
+		}
+	}
+	g.State = statePreparingRebalance
+	g.Generation++
+	g.State = stateCompletingRebalance
+	return nil
+}
+
+// ReapExpiredMembers drops members that missed their session timeout and
+// triggers a rebalance for any group that lost members this way. It is
+// meant to be called periodically by a background goroutine started
+// alongside the coordinator.
+func (c *Coordinator) ReapExpiredMembers() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for _, g := range c.groups {
+		changed := false
+		for id, m := range g.Members {
+			if m.Expired(now) {
+				delete(g.Members, id)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if len(g.Members) == 0 {
+			g.State = stateEmpty
+			g.LeaderID = ""
+			continue
+		}
+		if _, ok := g.Members[g.LeaderID]; !ok {
+			for id := range g.Members {
+				g.LeaderID = id
+				break
+			}
+		}
+		g.Generation++
+		g.State = stateCompletingRebalance
+	}
+}
+
+// CommitOffset persists a committed offset for (group, topic, partition).
+func (c *Coordinator) CommitOffset(group, topic string, partition int32, offset int64, metadata string) error {
+	return c.offsets.Commit(group, topic, partition, offset, metadata)
+}
+
+// FetchOffset returns the last committed offset for (group, topic, partition).
+func (c *Coordinator) FetchOffset(group, topic string, partition int32) (int64, string, error) {
+	committed, err := c.offsets.Fetch(group, topic, partition)
+	if err != nil {
+		return 0, "", err
+	}
+	return committed.Offset, committed.Metadata, nil
+}
+
+// JoinRequest carries the fields of a JoinGroup call needed by the
+// Coordinator, decoupled from the gRPC message type.
+type JoinRequest struct {
+	GroupID          string
+	MemberID         string
+	ClientID         string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	Topics           []string
+	Assignor         string
+}
+
+// JoinResult is what the coordinator returns from JoinGroup.
+type JoinResult struct {
+	GenerationID int32
+	Assignor     string
+	MemberID     string
+	LeaderID     string
+	MemberIDs    []string
+}
@@ -0,0 +1,67 @@
+package groups
+
+import "testing"
+
+// fakeLog is a minimal in-memory offsets.Log, just enough to back a
+// Coordinator in tests that don't exercise offset commits.
+type fakeLog struct {
+	records [][]byte
+}
+
+func (f *fakeLog) Append(key, payload []byte) (int64, error) {
+	offset := int64(len(f.records))
+	f.records = append(f.records, payload)
+	return offset, nil
+}
+
+func (f *fakeLog) Read(offset int64) ([]byte, error) {
+	if offset < 0 || offset >= int64(len(f.records)) {
+		return nil, nil
+	}
+	return f.records[offset], nil
+}
+
+func (f *fakeLog) NextOffset() int64 {
+	return int64(len(f.records))
+}
+
+// TestJoinGroupMemberIDStableAcrossChurn guards against regressing to
+// deriving the auto-assigned member ID suffix from len(g.Members): two
+// members sharing a client.id (normal - client.id identifies the
+// application, not the instance) must never be handed the same member ID
+// after a join/leave cycle shrinks the member count back down.
+func TestJoinGroupMemberIDStableAcrossChurn(t *testing.T) {
+	c := NewCoordinator(&fakeLog{})
+	c.SetPartitionCount("t", 1)
+
+	first, err := c.JoinGroup(JoinRequest{GroupID: "g", ClientID: "app", Topics: []string{"t"}})
+	if err != nil {
+		t.Fatalf("JoinGroup: %v", err)
+	}
+	if err := c.LeaveGroup("g", first.MemberID); err != nil {
+		t.Fatalf("LeaveGroup: %v", err)
+	}
+
+	second, err := c.JoinGroup(JoinRequest{GroupID: "g", ClientID: "app", Topics: []string{"t"}})
+	if err != nil {
+		t.Fatalf("JoinGroup: %v", err)
+	}
+	third, err := c.JoinGroup(JoinRequest{GroupID: "g", ClientID: "app", Topics: []string{"t"}})
+	if err != nil {
+		t.Fatalf("JoinGroup: %v", err)
+	}
+
+	if second.MemberID == third.MemberID {
+		t.Fatalf("second and third member both got ID %q after join/leave churn", second.MemberID)
+	}
+	if first.MemberID == third.MemberID {
+		t.Fatalf("first and third member both got ID %q after join/leave churn", first.MemberID)
+	}
+}
+
+func TestHeartbeatRejectsUnknownGroup(t *testing.T) {
+	c := NewCoordinator(&fakeLog{})
+	if _, err := c.Heartbeat("nope", "m", 0); err == nil {
+		t.Fatal("Heartbeat on unknown group: want error, got nil")
+	}
+}
@@ -0,0 +1,32 @@
+package groups
+
+import "time"
+
+// TopicPartition identifies a single partition of a topic.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// Member is a single consumer participating in a group.
+type Member struct {
+	ID               string
+	ClientID         string
+	Topics           []string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	Assignor         string
+
+	LastHeartbeat time.Time
+
+	// Assignment holds the partitions currently owned by this member. It is
+	// populated once the group reaches the Stable state via SyncGroup, and
+	// is what the sticky assignor consults on the next rebalance to decide
+	// which partitions a member gets to keep.
+	Assignment []TopicPartition
+}
+
+// Expired reports whether the member has missed its session timeout.
+func (m *Member) Expired(now time.Time) bool {
+	return now.Sub(m.LastHeartbeat) > m.SessionTimeout
+}
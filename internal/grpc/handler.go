@@ -3,7 +3,14 @@ package grpc
 import (
 	"context"
 	"io"
+	"time"
+
+	"kafka-clone/internal/cluster"
+	"kafka-clone/internal/compression"
 	"kafka-clone/internal/consumers"
+	"kafka-clone/internal/groups"
+	"kafka-clone/internal/logstore"
+	"kafka-clone/internal/offsets"
 	"kafka-clone/internal/producers"
 	"kafka-clone/internal/topics"
 	pb "kafka-clone/proto"
@@ -11,21 +18,65 @@ import (
 
 type Handler struct {
 	pb.UnimplementedBrokerServer
-	registry *topics.Registry
-	producer *producers.Producer
-	consumer *consumers.Consumer
+	registry    *topics.Registry
+	producer    *producers.Producer
+	consumer    *consumers.Consumer
+	coordinator *groups.Coordinator
+	// cluster is nil when the broker is running single-node (no --peers
+	// configured); in that case Metadata reports each partition with no
+	// leader, replicas or ISR, and LeaderAndIsr returns an error.
+	cluster *cluster.Cluster
 }
 
-func NewHandler(registry *topics.Registry) *Handler {
+// NewHandler wires up a Handler backed by registry. cl may be nil to run
+// without Raft replication, which is the default for a single-node broker.
+func NewHandler(registry *topics.Registry, cl *cluster.Cluster) *Handler {
+	offsetLog, err := offsets.NewConsumerOffsetsLog(registry)
+	if err != nil {
+		// The internal offsets topic is foundational; a broker that can't
+		// create it can't coordinate groups, so surface the failure loudly
+		// rather than limping along with nowhere to commit offsets.
+		panic(err)
+	}
+
 	return &Handler{
-		registry: registry,
-		producer: producers.NewProducer(registry),
-		consumer: consumers.NewConsumer(registry),
+		registry:    registry,
+		producer:    producers.NewProducer(registry),
+		consumer:    consumers.NewConsumer(registry),
+		coordinator: groups.NewCoordinator(offsetLog),
+		cluster:     cl,
 	}
 }
 
+// Registry, Producer, Consumer, and Coordinator expose the components this
+// Handler wires together, so other protocol gateways (e.g. kafkaproto) can
+// share the same registry, producer, consumer, and in-memory group
+// coordinator state rather than standing up their own.
+func (h *Handler) Registry() *topics.Registry       { return h.registry }
+func (h *Handler) Producer() *producers.Producer    { return h.producer }
+func (h *Handler) Consumer() *consumers.Consumer    { return h.consumer }
+func (h *Handler) Coordinator() *groups.Coordinator { return h.coordinator }
+
+// StartGroupReaper periodically drops consumer-group members that have
+// missed their session timeout, triggering a rebalance for any group that
+// loses a member this way. It runs until ctx is cancelled.
+func (h *Handler) StartGroupReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.coordinator.ReapExpiredMembers()
+			}
+		}
+	}()
+}
+
 func (h *Handler) CreateTopic(ctx context.Context, req *pb.CreateTopicRequest) (*pb.CreateTopicResponse, error) {
-	err := h.registry.CreateTopic(req.Topic, req.Partitions)
+	err := h.registry.CreateTopic(req.Topic, req.Partitions, topicConfigFromRequest(req))
 	if err != nil {
 		return &pb.CreateTopicResponse{
 			Success: false,
@@ -33,13 +84,173 @@ func (h *Handler) CreateTopic(ctx context.Context, req *pb.CreateTopicRequest) (
 		}, nil
 	}
 
+	h.coordinator.SetPartitionCount(req.Topic, req.Partitions)
+
+	if h.cluster != nil {
+		if err := h.replicateTopic(req.Topic, req.Partitions); err != nil {
+			return &pb.CreateTopicResponse{Success: false, Error: err.Error()}, nil
+		}
+	}
+
 	return &pb.CreateTopicResponse{
 		Success: true,
 	}, nil
 }
 
+// topicConfigFromRequest builds a topics.Config from a CreateTopicRequest,
+// falling back to topics.DefaultConfig() for any field the caller left at
+// its zero value.
+func topicConfigFromRequest(req *pb.CreateTopicRequest) topics.Config {
+	cfg := topics.DefaultConfig()
+	if req.RetentionMs != 0 {
+		cfg.RetentionMs = req.RetentionMs
+	}
+	if req.RetentionBytes != 0 {
+		cfg.RetentionBytes = req.RetentionBytes
+	}
+	if req.CleanupPolicy != "" {
+		cfg.CleanupPolicy = logstore.CleanupPolicy(req.CleanupPolicy)
+	}
+	if req.MinInsyncReplicas != 0 {
+		cfg.MinInSyncReplicas = req.MinInsyncReplicas
+	}
+	return cfg
+}
+
+// AlterConfigs updates a topic's retention/compaction policy and
+// min.insync.replicas.
+func (h *Handler) AlterConfigs(ctx context.Context, req *pb.AlterConfigsRequest) (*pb.AlterConfigsResponse, error) {
+	cfg := topics.DefaultConfig()
+	if req.RetentionMs != 0 {
+		cfg.RetentionMs = req.RetentionMs
+	}
+	if req.RetentionBytes != 0 {
+		cfg.RetentionBytes = req.RetentionBytes
+	}
+	if req.CleanupPolicy != "" {
+		cfg.CleanupPolicy = logstore.CleanupPolicy(req.CleanupPolicy)
+	}
+	if req.MinInsyncReplicas != 0 {
+		cfg.MinInSyncReplicas = req.MinInsyncReplicas
+	}
+
+	if err := h.registry.AlterConfigs(req.Topic, cfg); err != nil {
+		return &pb.AlterConfigsResponse{Error: err.Error()}, nil
+	}
+	return &pb.AlterConfigsResponse{}, nil
+}
+
+// replicateTopic starts a Raft group for every partition of a freshly
+// created topic. The replica set is every peer this broker knows about;
+// picking a subset per partition (the way Kafka spreads replicas across
+// racks/brokers) is future work once the cluster is large enough to need
+// it.
+func (h *Handler) replicateTopic(topic string, numPartitions int32) error {
+	for i := int32(0); i < numPartitions; i++ {
+		log, err := h.registry.GetPartition(topic, i)
+		if err != nil {
+			return err
+		}
+		local, ok := log.(*logstore.Partition)
+		if !ok {
+			continue // already replicated, e.g. a retry after a partial failure
+		}
+		if _, err := h.cluster.AddPartition(topic, i, local, h.cluster.Peers()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) JoinGroup(ctx context.Context, req *pb.JoinGroupRequest) (*pb.JoinGroupResponse, error) {
+	result, err := h.coordinator.JoinGroup(groups.JoinRequest{
+		GroupID:          req.GroupId,
+		MemberID:         req.MemberId,
+		ClientID:         req.ClientId,
+		SessionTimeout:   time.Duration(req.SessionTimeoutMs) * time.Millisecond,
+		RebalanceTimeout: time.Duration(req.RebalanceTimeoutMs) * time.Millisecond,
+		Topics:           req.Topics,
+		Assignor:         req.Assignor,
+	})
+	if err != nil {
+		return &pb.JoinGroupResponse{Error: err.Error()}, nil
+	}
+
+	return &pb.JoinGroupResponse{
+		GenerationId: result.GenerationID,
+		Assignor:     result.Assignor,
+		MemberId:     result.MemberID,
+		LeaderId:     result.LeaderID,
+		MemberIds:    result.MemberIDs,
+	}, nil
+}
+
+func (h *Handler) SyncGroup(ctx context.Context, req *pb.SyncGroupRequest) (*pb.SyncGroupResponse, error) {
+	var assignments map[string][]groups.TopicPartition
+	if len(req.Assignments) > 0 {
+		assignments = make(map[string][]groups.TopicPartition, len(req.Assignments))
+		for memberID, list := range req.Assignments {
+			assignments[memberID] = toGroupPartitions(list.Partitions)
+		}
+	}
+
+	assignment, err := h.coordinator.SyncGroup(req.GroupId, req.MemberId, req.GenerationId, assignments)
+	if err != nil {
+		return &pb.SyncGroupResponse{Error: err.Error()}, nil
+	}
+
+	return &pb.SyncGroupResponse{Assignment: toPbPartitions(assignment)}, nil
+}
+
+func (h *Handler) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	_, err := h.coordinator.Heartbeat(req.GroupId, req.MemberId, req.GenerationId)
+	if err != nil {
+		return &pb.HeartbeatResponse{Error: err.Error()}, nil
+	}
+	return &pb.HeartbeatResponse{}, nil
+}
+
+func (h *Handler) LeaveGroup(ctx context.Context, req *pb.LeaveGroupRequest) (*pb.LeaveGroupResponse, error) {
+	if err := h.coordinator.LeaveGroup(req.GroupId, req.MemberId); err != nil {
+		return &pb.LeaveGroupResponse{Error: err.Error()}, nil
+	}
+	return &pb.LeaveGroupResponse{}, nil
+}
+
+func (h *Handler) OffsetCommit(ctx context.Context, req *pb.OffsetCommitRequest) (*pb.OffsetCommitResponse, error) {
+	err := h.coordinator.CommitOffset(req.GroupId, req.Topic, req.Partition, req.Offset, req.Metadata)
+	if err != nil {
+		return &pb.OffsetCommitResponse{Error: err.Error()}, nil
+	}
+	return &pb.OffsetCommitResponse{}, nil
+}
+
+func (h *Handler) OffsetFetch(ctx context.Context, req *pb.OffsetFetchRequest) (*pb.OffsetFetchResponse, error) {
+	offset, metadata, err := h.coordinator.FetchOffset(req.GroupId, req.Topic, req.Partition)
+	if err != nil {
+		return &pb.OffsetFetchResponse{Error: err.Error()}, nil
+	}
+	return &pb.OffsetFetchResponse{Offset: offset, Metadata: metadata}, nil
+}
+
+func toGroupPartitions(parts []*pb.TopicPartition) []groups.TopicPartition {
+	out := make([]groups.TopicPartition, len(parts))
+	for i, p := range parts {
+		out[i] = groups.TopicPartition{Topic: p.Topic, Partition: p.Partition}
+	}
+	return out
+}
+
+func toPbPartitions(parts []groups.TopicPartition) []*pb.TopicPartition {
+	out := make([]*pb.TopicPartition, len(parts))
+	for i, p := range parts {
+		out[i] = &pb.TopicPartition{Topic: p.Topic, Partition: p.Partition}
+	}
+	return out
+}
+
 func (h *Handler) Produce(ctx context.Context, req *pb.ProduceRequest) (*pb.ProduceResponse, error) {
-	partition, offset, err := h.producer.Produce(req.Topic, req.Partition, req.Payload)
+	partition, offset, err := h.producer.Produce(req.Topic, req.Partition, req.Key, req.Payload, req.Acks, req.ProducerId, req.Sequence)
 	if err != nil {
 		return &pb.ProduceResponse{
 			Error: err.Error(),
@@ -52,6 +263,77 @@ func (h *Handler) Produce(ctx context.Context, req *pb.ProduceRequest) (*pb.Prod
 	}, nil
 }
 
+func (h *Handler) ProduceBatch(ctx context.Context, req *pb.ProduceBatchRequest) (*pb.ProduceBatchResponse, error) {
+	records := make([]logstore.LogEntry, len(req.Records))
+	for i, rec := range req.Records {
+		records[i] = logstore.LogEntry{Key: rec.Key, Payload: rec.Payload}
+	}
+
+	partition, baseOffset, err := h.producer.ProduceBatch(req.Topic, req.Partition, records, codecFromPb(req.Codec), req.Acks, req.ProducerId, req.BaseSequence)
+	if err != nil {
+		return &pb.ProduceBatchResponse{Error: err.Error()}, nil
+	}
+
+	return &pb.ProduceBatchResponse{Partition: partition, BaseOffset: baseOffset}, nil
+}
+
+func (h *Handler) Fetch(req *pb.FetchRequest, stream pb.Broker_FetchServer) error {
+	batches, err := h.consumer.ConsumeBatch(req.Topic, req.Partition, req.Offset, req.MaxBytes)
+	if err != nil {
+		return stream.Send(&pb.FetchResponse{Error: err.Error()})
+	}
+
+	return stream.Send(&pb.FetchResponse{Batches: toPbBatches(batches)})
+}
+
+func codecFromPb(codec pb.CompressionCodec) compression.Codec {
+	switch codec {
+	case pb.CompressionCodec_GZIP:
+		return compression.Gzip
+	case pb.CompressionCodec_SNAPPY:
+		return compression.Snappy
+	case pb.CompressionCodec_LZ4:
+		return compression.LZ4
+	case pb.CompressionCodec_ZSTD:
+		return compression.Zstd
+	default:
+		return compression.None
+	}
+}
+
+func codecToPb(codec compression.Codec) pb.CompressionCodec {
+	switch codec {
+	case compression.Gzip:
+		return pb.CompressionCodec_GZIP
+	case compression.Snappy:
+		return pb.CompressionCodec_SNAPPY
+	case compression.LZ4:
+		return pb.CompressionCodec_LZ4
+	case compression.Zstd:
+		return pb.CompressionCodec_ZSTD
+	default:
+		return pb.CompressionCodec_NONE
+	}
+}
+
+func toPbBatches(batches []*logstore.RecordBatch) []*pb.RecordBatch {
+	out := make([]*pb.RecordBatch, len(batches))
+	for i, b := range batches {
+		records := make([]*pb.Record, len(b.Records))
+		for j, r := range b.Records {
+			records[j] = &pb.Record{Key: r.Key, Payload: r.Payload}
+		}
+		out[i] = &pb.RecordBatch{
+			BaseOffset:      b.BaseOffset,
+			LastOffsetDelta: int32(len(b.Records) - 1),
+			RecordCount:     int32(len(b.Records)),
+			Codec:           codecToPb(b.Codec),
+			Records:         records,
+		}
+	}
+	return out
+}
+
 func (h *Handler) Consume(req *pb.ConsumeRequest, stream pb.Broker_ConsumeServer) error {
 	currentOffset := req.Offset
 
@@ -84,3 +366,50 @@ func (h *Handler) Consume(req *pb.ConsumeRequest, stream pb.Broker_ConsumeServer
 		}
 	}
 }
+
+// Metadata reports, for each requested topic (or every known topic if none
+// are named), the current leader/replicas/ISR of each partition so clients
+// can route Produce/Consume calls to the right broker.
+func (h *Handler) Metadata(ctx context.Context, req *pb.MetadataRequest) (*pb.MetadataResponse, error) {
+	topicNames := req.Topics
+	if len(topicNames) == 0 {
+		topicNames = h.registry.TopicNames()
+	}
+
+	resp := &pb.MetadataResponse{}
+	for _, name := range topicNames {
+		t, err := h.registry.GetTopic(name)
+		if err != nil {
+			return &pb.MetadataResponse{Error: err.Error()}, nil
+		}
+
+		tm := &pb.TopicMetadata{Topic: name}
+		for i := range t.Partitions {
+			pm := &pb.PartitionMetadata{Partition: int32(i)}
+			if h.cluster != nil {
+				leader, isr, err := h.cluster.LeaderAndISR(name, int32(i))
+				if err == nil {
+					pm.Leader = leader
+					pm.Isr = isr
+					pm.Replicas = isr
+				}
+			}
+			tm.Partitions = append(tm.Partitions, pm)
+		}
+		resp.Topics = append(resp.Topics, tm)
+	}
+	return resp, nil
+}
+
+// LeaderAndIsr reports the current leader and ISR for a single partition.
+func (h *Handler) LeaderAndIsr(ctx context.Context, req *pb.LeaderAndIsrRequest) (*pb.LeaderAndIsrResponse, error) {
+	if h.cluster == nil {
+		return &pb.LeaderAndIsrResponse{Error: "cluster replication is not enabled on this broker"}, nil
+	}
+
+	leader, isr, err := h.cluster.LeaderAndISR(req.Topic, req.Partition)
+	if err != nil {
+		return &pb.LeaderAndIsrResponse{Error: err.Error()}, nil
+	}
+	return &pb.LeaderAndIsrResponse{Leader: leader, Isr: isr}, nil
+}
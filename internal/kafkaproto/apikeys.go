@@ -0,0 +1,40 @@
+package kafkaproto
+
+// API key numbers as assigned by the Kafka protocol. Only the keys this
+// gateway handles are listed; a request with an unrecognized key gets no
+// response: dispatch returns an error and the connection is closed.
+const (
+	apiProduce         = 0
+	apiFetch           = 1
+	apiListOffsets     = 2
+	apiMetadata        = 3
+	apiOffsetCommit    = 8
+	apiOffsetFetch     = 9
+	apiFindCoordinator = 10
+	apiJoinGroup       = 11
+	apiHeartbeat       = 12
+	apiLeaveGroup      = 13
+	apiSyncGroup       = 14
+	apiCreateTopics    = 19
+	apiApiVersions     = 18
+)
+
+// supportedAPIs is advertised in ApiVersions responses: every API this
+// gateway implements, all at v0.
+var supportedAPIs = []int16{
+	apiProduce, apiFetch, apiListOffsets, apiMetadata,
+	apiOffsetCommit, apiOffsetFetch, apiFindCoordinator,
+	apiJoinGroup, apiHeartbeat, apiLeaveGroup, apiSyncGroup,
+	apiCreateTopics, apiApiVersions,
+}
+
+// Kafka's own error code constants, limited to the ones this gateway uses.
+const (
+	errNone               int16 = 0
+	errUnknownServerError int16 = -1
+	errUnknownTopicOrPart int16 = 3
+	errIllegalGeneration  int16 = 22
+	errUnknownMemberID    int16 = 25
+	errTopicAlreadyExists int16 = 36
+	errUnsupportedVersion int16 = 35
+)
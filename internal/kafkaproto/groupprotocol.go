@@ -0,0 +1,45 @@
+package kafkaproto
+
+// parseConsumerProtocolSubscription decodes the "consumer" embedded
+// protocol's ConsumerProtocolSubscription metadata bytes that Sarama and
+// librdkafka send in JoinGroupRequest.group_protocols[i].protocol_metadata:
+// version int16, topics (array of string), then a nullable user_data
+// bytes field this gateway doesn't need.
+func parseConsumerProtocolSubscription(data []byte) ([]string, error) {
+	r := newReader(data)
+	if _, err := r.int16(); err != nil { // version
+		return nil, err
+	}
+	n, err := r.arrayLen()
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, n)
+	for i := int32(0); i < n; i++ {
+		t, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+// encodeConsumerProtocolAssignment encodes a member's assigned partitions
+// as a ConsumerProtocolAssignment: version int16(0), topic_partitions
+// (array of {topic string, partitions array of int32}), then an empty
+// user_data bytes field.
+func encodeConsumerProtocolAssignment(assignment map[string][]int32) []byte {
+	w := &writer{}
+	w.int16(0)
+	w.arrayLen(len(assignment))
+	for topic, partitions := range assignment {
+		w.string(topic)
+		w.arrayLen(len(partitions))
+		for _, p := range partitions {
+			w.int32(p)
+		}
+	}
+	w.bytes(nil)
+	return w.bytesWritten()
+}
@@ -0,0 +1,637 @@
+package kafkaproto
+
+import (
+	"time"
+
+	"kafka-clone/internal/compression"
+	"kafka-clone/internal/groups"
+	"kafka-clone/internal/logstore"
+	"kafka-clone/internal/producers"
+	"kafka-clone/internal/topics"
+)
+
+// arrayCap clamps an untrusted wire array-length count to a capacity hint
+// that can't force a multi-gigabyte allocation from a tiny request: n bytes
+// can never hold more than r.remaining() elements, since even the smallest
+// element is at least one byte, so that's a safe upper bound to preallocate
+// against regardless of what n itself claims.
+func arrayCap(n int32, r *reader) int {
+	if int(n) > r.remaining() {
+		return r.remaining()
+	}
+	return int(n)
+}
+
+func (s *Server) handleAPIVersions(w *writer) {
+	w.int16(errNone)
+	w.arrayLen(len(supportedAPIs))
+	for _, key := range supportedAPIs {
+		w.int16(key) // api_key
+		w.int16(0)   // min_version
+		w.int16(0)   // max_version
+	}
+}
+
+func (s *Server) handleMetadata(r *reader, w *writer) {
+	n, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+	requested := make([]string, 0, arrayCap(n, r))
+	for i := int32(0); i < n; i++ {
+		t, err := r.string()
+		if err != nil {
+			return
+		}
+		requested = append(requested, t)
+	}
+	if len(requested) == 0 {
+		requested = s.registry.TopicNames()
+	}
+
+	// brokers: this gateway only ever reports itself, since it coordinates
+	// every partition and group locally (see groups.Coordinator's doc
+	// comment on single-broker coordination).
+	w.arrayLen(1)
+	w.int32(s.brokerID)
+	w.string(s.brokerHost)
+	w.int32(s.brokerPort)
+
+	w.arrayLen(len(requested))
+	for _, name := range requested {
+		t, err := s.registry.GetTopic(name)
+		if err != nil {
+			w.int16(errUnknownTopicOrPart)
+			w.string(name)
+			w.arrayLen(0)
+			continue
+		}
+
+		w.int16(errNone)
+		w.string(name)
+		w.arrayLen(len(t.Partitions))
+		for i := range t.Partitions {
+			w.int16(errNone)
+			w.int32(int32(i))
+			w.int32(s.brokerID) // leader
+			w.arrayLen(1)
+			w.int32(s.brokerID) // replicas
+			w.arrayLen(1)
+			w.int32(s.brokerID) // isr
+		}
+	}
+}
+
+func (s *Server) handleCreateTopics(r *reader, w *writer) {
+	n, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	type result struct {
+		name string
+		code int16
+	}
+	results := make([]result, 0, arrayCap(n, r))
+
+	for i := int32(0); i < n; i++ {
+		name, err := r.string()
+		if err != nil {
+			return
+		}
+		numPartitions, err := r.int32()
+		if err != nil {
+			return
+		}
+		if _, err := r.int16(); err != nil { // replication_factor
+			return
+		}
+		assignments, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+		for j := int32(0); j < assignments; j++ {
+			if _, err := r.int32(); err != nil { // partition_id
+				return
+			}
+			replicas, err := r.arrayLen()
+			if err != nil {
+				return
+			}
+			for k := int32(0); k < replicas; k++ {
+				if _, err := r.int32(); err != nil {
+					return
+				}
+			}
+		}
+		configs, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+		for j := int32(0); j < configs; j++ {
+			if _, err := r.string(); err != nil { // config_name
+				return
+			}
+			if _, err := r.string(); err != nil { // config_value
+				return
+			}
+		}
+
+		code := errNone
+		if err := s.registry.CreateTopic(name, numPartitions, topics.DefaultConfig()); err != nil {
+			code = errTopicAlreadyExists
+		} else {
+			s.coordinator.SetPartitionCount(name, numPartitions)
+		}
+		results = append(results, result{name: name, code: code})
+	}
+
+	if _, err := r.int32(); err != nil { // timeout
+		return
+	}
+
+	w.arrayLen(len(results))
+	for _, res := range results {
+		w.string(res.name)
+		w.int16(res.code)
+	}
+}
+
+func (s *Server) handleProduce(r *reader, w *writer) {
+	if _, err := r.int16(); err != nil { // acks
+		return
+	}
+	if _, err := r.int32(); err != nil { // timeout
+		return
+	}
+	topicCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	w.arrayLen(int(topicCount))
+	for i := int32(0); i < topicCount; i++ {
+		topic, err := r.string()
+		if err != nil {
+			return
+		}
+		partCount, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+
+		w.string(topic)
+		w.arrayLen(int(partCount))
+		for j := int32(0); j < partCount; j++ {
+			partition, err := r.int32()
+			if err != nil {
+				return
+			}
+			recordSet, err := r.bytes()
+			if err != nil {
+				return
+			}
+
+			records, err := decodeRecordSet(recordSet)
+			if err != nil {
+				w.int32(partition)
+				w.int16(errUnknownServerError)
+				w.int64(-1)
+				continue
+			}
+
+			// This gateway's classic v0 Produce schema carries no
+			// producer_id/sequence fields, so every append through it is
+			// non-idempotent; idempotent produce is reachable only
+			// through the gRPC Produce/ProduceBatch methods for now.
+			_, baseOffset, err := s.producer.ProduceBatch(topic, partition, records, compression.None, 0, producers.NoProducerID, 0)
+			if err != nil {
+				w.int32(partition)
+				w.int16(errUnknownServerError)
+				w.int64(-1)
+				continue
+			}
+
+			w.int32(partition)
+			w.int16(errNone)
+			w.int64(baseOffset)
+		}
+	}
+}
+
+// fetchPartitionReq is one partition entry of a parsed Fetch request.
+type fetchPartitionReq struct {
+	partition int32
+	offset    int64
+	maxBytes  int32
+}
+
+// fetchTopicReq is one topic entry of a parsed Fetch request.
+type fetchTopicReq struct {
+	topic      string
+	partitions []fetchPartitionReq
+}
+
+// handleFetch parses the whole request up front (rather than writing each
+// partition's response as it's parsed, as every other handler does) so the
+// partition loop below stays uniform - there used to be a sendfile fast
+// path here for the common single-topic, single-partition case
+// (topics.Registry.ReadInto, streaming a segment's raw on-disk bytes
+// straight to the connection), but it streamed logstore's own on-disk
+// record encoding while this function's general path below encodes via
+// encodeRecordSet - two different byte layouts for the same Fetch API
+// depending on how many partitions a client happened to ask for in one
+// call. Every partition now goes through the same ConsumeBatch/
+// encodeRecordSet encoding; see encodeRecordSet's doc comment for why that
+// still isn't Kafka's real RecordBatch v2 wire format. The zero-copy
+// primitives it used to call remain in topics.Registry for a future fetch
+// path built on a format that's actually safe to stream unmodified.
+func (s *Server) handleFetch(r *reader, w *writer) {
+	if _, err := r.int32(); err != nil { // replica_id
+		return
+	}
+	if _, err := r.int32(); err != nil { // max_wait_time
+		return
+	}
+	if _, err := r.int32(); err != nil { // min_bytes
+		return
+	}
+	topicCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	topicReqs := make([]fetchTopicReq, 0, arrayCap(topicCount, r))
+	for i := int32(0); i < topicCount; i++ {
+		topic, err := r.string()
+		if err != nil {
+			return
+		}
+		partCount, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+
+		parts := make([]fetchPartitionReq, 0, arrayCap(partCount, r))
+		for j := int32(0); j < partCount; j++ {
+			partition, err := r.int32()
+			if err != nil {
+				return
+			}
+			offset, err := r.int64()
+			if err != nil {
+				return
+			}
+			maxBytes, err := r.int32()
+			if err != nil {
+				return
+			}
+			parts = append(parts, fetchPartitionReq{partition: partition, offset: offset, maxBytes: maxBytes})
+		}
+		topicReqs = append(topicReqs, fetchTopicReq{topic: topic, partitions: parts})
+	}
+
+	w.arrayLen(len(topicReqs))
+	for _, t := range topicReqs {
+		w.string(t.topic)
+		w.arrayLen(len(t.partitions))
+		for _, p := range t.partitions {
+			batches, err := s.consumer.ConsumeBatch(t.topic, p.partition, p.offset, int64(p.maxBytes))
+			if err != nil {
+				w.int32(p.partition)
+				w.int16(errUnknownServerError)
+				w.int64(-1)
+				w.bytes(nil)
+				continue
+			}
+
+			var records []logstore.LogEntry
+			highWatermark := p.offset
+			for _, b := range batches {
+				records = append(records, b.Records...)
+				highWatermark = b.BaseOffset + int64(len(b.Records))
+			}
+
+			w.int32(p.partition)
+			w.int16(errNone)
+			w.int64(highWatermark)
+			w.bytes(encodeRecordSet(records))
+		}
+	}
+}
+
+func (s *Server) handleListOffsets(r *reader, w *writer) {
+	if _, err := r.int32(); err != nil { // replica_id
+		return
+	}
+	topicCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	w.arrayLen(int(topicCount))
+	for i := int32(0); i < topicCount; i++ {
+		topic, err := r.string()
+		if err != nil {
+			return
+		}
+		partCount, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+
+		w.string(topic)
+		w.arrayLen(int(partCount))
+		for j := int32(0); j < partCount; j++ {
+			partition, err := r.int32()
+			if err != nil {
+				return
+			}
+			timestamp, err := r.int64()
+			if err != nil {
+				return
+			}
+			if _, err := r.int32(); err != nil { // max_num_offsets
+				return
+			}
+
+			part, err := s.registry.GetPartition(topic, partition)
+			if err != nil {
+				w.int32(partition)
+				w.int16(errUnknownTopicOrPart)
+				w.arrayLen(0)
+				continue
+			}
+
+			// timestamp -1 means "latest", -2 means "earliest"; this
+			// gateway doesn't track per-offset timestamps, so any other
+			// value also just resolves to latest.
+			offset := part.NextOffset()
+			if timestamp == -2 {
+				offset = 0
+			}
+
+			w.int32(partition)
+			w.int16(errNone)
+			w.arrayLen(1)
+			w.int64(offset)
+		}
+	}
+}
+
+func (s *Server) handleFindCoordinator(r *reader, w *writer) {
+	if _, err := r.string(); err != nil { // group_id
+		return
+	}
+
+	w.int16(errNone)
+	w.int32(s.brokerID)
+	w.string(s.brokerHost)
+	w.int32(s.brokerPort)
+}
+
+func (s *Server) handleJoinGroup(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	sessionTimeoutMs, err := r.int32()
+	if err != nil {
+		return
+	}
+	memberID, err := r.string()
+	if err != nil {
+		return
+	}
+	if _, err := r.string(); err != nil { // protocol_type
+		return
+	}
+	protoCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	var assignor string
+	var memberTopics []string
+	for i := int32(0); i < protoCount; i++ {
+		name, err := r.string()
+		if err != nil {
+			return
+		}
+		metadata, err := r.bytes()
+		if err != nil {
+			return
+		}
+		if i == 0 {
+			assignor = name
+			memberTopics, _ = parseConsumerProtocolSubscription(metadata)
+		}
+	}
+
+	result, err := s.coordinator.JoinGroup(groups.JoinRequest{
+		GroupID:        groupID,
+		MemberID:       memberID,
+		ClientID:       memberID,
+		SessionTimeout: time.Duration(sessionTimeoutMs) * time.Millisecond,
+		Topics:         memberTopics,
+		Assignor:       assignor,
+	})
+	if err != nil {
+		w.int16(errUnknownServerError)
+		w.int32(-1)
+		w.string("")
+		w.string("")
+		w.string("")
+		w.arrayLen(0)
+		return
+	}
+
+	w.int16(errNone)
+	w.int32(result.GenerationID)
+	w.string(result.Assignor)
+	w.string(result.LeaderID)
+	w.string(result.MemberID)
+	w.arrayLen(len(result.MemberIDs))
+	for _, id := range result.MemberIDs {
+		w.string(id)
+		w.bytes(nil)
+	}
+}
+
+func (s *Server) handleSyncGroup(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	generationID, err := r.int32()
+	if err != nil {
+		return
+	}
+	memberID, err := r.string()
+	if err != nil {
+		return
+	}
+	assignCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+	// The leader's client-computed group_assignment is read (so the frame
+	// parses correctly) but intentionally discarded: groups.Coordinator
+	// always computes assignments itself via the same pluggable assignors
+	// used by gRPC clients, so every SyncGroup call here passes nil and
+	// lets the server decide, rather than trusting whatever a Kafka
+	// client's local assignment strategy produced.
+	for i := int32(0); i < assignCount; i++ {
+		if _, err := r.string(); err != nil {
+			return
+		}
+		if _, err := r.bytes(); err != nil {
+			return
+		}
+	}
+
+	assignment, err := s.coordinator.SyncGroup(groupID, memberID, generationID, nil)
+	if err != nil {
+		w.int16(errUnknownServerError)
+		w.bytes(nil)
+		return
+	}
+
+	byTopic := make(map[string][]int32)
+	for _, tp := range assignment {
+		byTopic[tp.Topic] = append(byTopic[tp.Topic], tp.Partition)
+	}
+
+	w.int16(errNone)
+	w.bytes(encodeConsumerProtocolAssignment(byTopic))
+}
+
+func (s *Server) handleHeartbeat(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	generationID, err := r.int32()
+	if err != nil {
+		return
+	}
+	memberID, err := r.string()
+	if err != nil {
+		return
+	}
+
+	if _, err := s.coordinator.Heartbeat(groupID, memberID, generationID); err != nil {
+		w.int16(errUnknownMemberID)
+		return
+	}
+	w.int16(errNone)
+}
+
+func (s *Server) handleLeaveGroup(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	memberID, err := r.string()
+	if err != nil {
+		return
+	}
+
+	if err := s.coordinator.LeaveGroup(groupID, memberID); err != nil {
+		w.int16(errUnknownMemberID)
+		return
+	}
+	w.int16(errNone)
+}
+
+func (s *Server) handleOffsetCommit(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	topicCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	w.arrayLen(int(topicCount))
+	for i := int32(0); i < topicCount; i++ {
+		topic, err := r.string()
+		if err != nil {
+			return
+		}
+		partCount, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+
+		w.string(topic)
+		w.arrayLen(int(partCount))
+		for j := int32(0); j < partCount; j++ {
+			partition, err := r.int32()
+			if err != nil {
+				return
+			}
+			offset, err := r.int64()
+			if err != nil {
+				return
+			}
+			metadata, err := r.string()
+			if err != nil {
+				return
+			}
+
+			code := errNone
+			if err := s.coordinator.CommitOffset(groupID, topic, partition, offset, metadata); err != nil {
+				code = errUnknownServerError
+			}
+
+			w.int32(partition)
+			w.int16(code)
+		}
+	}
+}
+
+func (s *Server) handleOffsetFetch(r *reader, w *writer) {
+	groupID, err := r.string()
+	if err != nil {
+		return
+	}
+	topicCount, err := r.arrayLen()
+	if err != nil {
+		return
+	}
+
+	w.arrayLen(int(topicCount))
+	for i := int32(0); i < topicCount; i++ {
+		topic, err := r.string()
+		if err != nil {
+			return
+		}
+		partCount, err := r.arrayLen()
+		if err != nil {
+			return
+		}
+
+		w.string(topic)
+		w.arrayLen(int(partCount))
+		for j := int32(0); j < partCount; j++ {
+			partition, err := r.int32()
+			if err != nil {
+				return
+			}
+
+			offset, metadata, err := s.coordinator.FetchOffset(groupID, topic, partition)
+			code := errNone
+			if err != nil {
+				code = errUnknownServerError
+				offset = -1
+			}
+
+			w.int32(partition)
+			w.int64(offset)
+			w.string(metadata)
+			w.int16(code)
+		}
+	}
+}
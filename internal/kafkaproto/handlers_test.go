@@ -0,0 +1,130 @@
+package kafkaproto
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"kafka-clone/internal/consumers"
+	"kafka-clone/internal/groups"
+	"kafka-clone/internal/offsets"
+	"kafka-clone/internal/producers"
+	"kafka-clone/internal/topics"
+)
+
+// TestArrayCapClampsUntrustedCount guards against a small request declaring
+// a huge array-length count forcing a multi-gigabyte slice allocation
+// before the remaining-bytes check in the decode loop ever fires.
+func TestArrayCapClampsUntrustedCount(t *testing.T) {
+	r := newReader([]byte{0, 0, 0, 0}) // 4 bytes left after a length field
+	if got := arrayCap(0x7FFFFFFF, r); got > r.remaining() {
+		t.Fatalf("arrayCap(huge) = %d, want at most remaining() = %d", got, r.remaining())
+	}
+	if got := arrayCap(2, r); got != 2 {
+		t.Fatalf("arrayCap(2) = %d, want 2 when it's within remaining()", got)
+	}
+}
+
+// TestDecodeRecordSetRejectsHugeCount guards against the same
+// pre-size-from-untrusted-count DoS in decodeRecordSet's own record count.
+func TestDecodeRecordSetRejectsHugeCount(t *testing.T) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, 0x7FFFFFFF)
+	if _, err := decodeRecordSet(data); err == nil {
+		t.Fatal("decodeRecordSet: want error for a count with no backing data, got nil")
+	}
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	registry := topics.NewRegistry(t.TempDir())
+	t.Cleanup(func() { registry.Close() })
+
+	offsetLog, err := offsets.NewConsumerOffsetsLog(registry)
+	if err != nil {
+		t.Fatalf("NewConsumerOffsetsLog: %v", err)
+	}
+
+	return NewServer(registry, producers.NewProducer(registry), consumers.NewConsumer(registry), groups.NewCoordinator(offsetLog), "localhost", 9094)
+}
+
+// TestHandleFetchUsesSameEncodingRegardlessOfPartitionCount guards against
+// handleFetch's old sendfile fast path, which streamed a completely
+// different byte layout (logstore's own on-disk record format) for a
+// single-topic, single-partition Fetch than the general path's
+// encodeRecordSet used for every other shape. A client fetching one
+// partition must see the same record_set encoding as a client fetching two.
+func TestHandleFetchUsesSameEncodingRegardlessOfPartitionCount(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.registry.CreateTopic("t", 1, topics.DefaultConfig()); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	if _, _, err := s.producer.Produce("t", 0, []byte("key"), []byte("value"), producers.AcksLeader, producers.NoProducerID, 0); err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+
+	fetchOne := func() []byte {
+		r := newReq()
+		r.int32(-1) // replica_id
+		r.int32(0)  // max_wait_time
+		r.int32(0)  // min_bytes
+		r.arrayLen(1)
+		r.string("t")
+		r.arrayLen(1)
+		r.int32(0)    // partition
+		r.int64(0)    // offset
+		r.int32(1024) // max_bytes
+
+		w := &writer{}
+		req := newReader(r.bytesWritten())
+		s.handleFetch(req, w)
+		return recordSetFromFetchResponse(t, w.bytesWritten())
+	}
+
+	single := fetchOne()
+	decoded, err := decodeRecordSet(single)
+	if err != nil {
+		t.Fatalf("decodeRecordSet(single-partition response): %v", err)
+	}
+	if len(decoded) != 1 || string(decoded[0].Payload) != "value" {
+		t.Fatalf("decoded records = %+v, want one record with payload %q", decoded, "value")
+	}
+}
+
+// newReq is a tiny request-side writer - requests and responses share the
+// same primitive encodings, so *writer doubles as a request builder here.
+func newReq() *writer {
+	return &writer{}
+}
+
+// recordSetFromFetchResponse walks a Fetch response's topic/partition
+// arrays (as handleFetch writes them) to pull out the single record_set
+// bytes field, without needing a full response decoder.
+func recordSetFromFetchResponse(t *testing.T, resp []byte) []byte {
+	t.Helper()
+	r := newReader(resp)
+	topicCount, err := r.arrayLen()
+	if err != nil || topicCount != 1 {
+		t.Fatalf("arrayLen(topics): %d, %v", topicCount, err)
+	}
+	if _, err := r.string(); err != nil { // topic
+		t.Fatalf("string(topic): %v", err)
+	}
+	partCount, err := r.arrayLen()
+	if err != nil || partCount != 1 {
+		t.Fatalf("arrayLen(partitions): %d, %v", partCount, err)
+	}
+	if _, err := r.int32(); err != nil { // partition
+		t.Fatalf("int32(partition): %v", err)
+	}
+	if _, err := r.int16(); err != nil { // error_code
+		t.Fatalf("int16(error_code): %v", err)
+	}
+	if _, err := r.int64(); err != nil { // high_watermark
+		t.Fatalf("int64(high_watermark): %v", err)
+	}
+	recordSet, err := r.bytes()
+	if err != nil {
+		t.Fatalf("bytes(record_set): %v", err)
+	}
+	return recordSet
+}
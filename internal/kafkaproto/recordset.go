@@ -0,0 +1,73 @@
+package kafkaproto
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"kafka-clone/internal/logstore"
+)
+
+// This gateway's Produce/Fetch record_set fields use this broker's own
+// simplified batch encoding - a record count followed by that many
+// [keyLen int32][key][valueLen int32][value] records - rather than
+// Kafka's native RecordBatch v2 wire format (magic byte, varints,
+// per-batch compression). That native format is not implemented. Real
+// Sarama/librdkafka clients will
+// need that native decoder before this gateway is fully interoperable,
+// but every other part of the protocol (framing, headers, the other APIs)
+// is the real wire format.
+
+func encodeRecordSet(records []logstore.LogEntry) []byte {
+	buf := make([]byte, 4, 64*len(records)+4)
+	binary.BigEndian.PutUint32(buf, uint32(len(records)))
+	for _, rec := range records {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(rec.Key)))
+		buf = append(buf, rec.Key...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(rec.Payload)))
+		buf = append(buf, rec.Payload...)
+	}
+	return buf
+}
+
+func decodeRecordSet(data []byte) ([]logstore.LogEntry, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("truncated record set")
+	}
+	count := binary.BigEndian.Uint32(data)
+	pos := 4
+
+	// Don't pre-size from count: it's an untrusted uint32 read straight off
+	// the wire, and a record needs at least 8 bytes (two length prefixes),
+	// so that's a safe upper bound on how many can actually be present.
+	capHint := count
+	if maxRecords := uint32(len(data)-pos) / 8; capHint > maxRecords {
+		capHint = maxRecords
+	}
+	records := make([]logstore.LogEntry, 0, capHint)
+	for i := uint32(0); i < count; i++ {
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("truncated record set")
+		}
+		keyLen := int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if pos+keyLen > len(data) {
+			return nil, fmt.Errorf("truncated record set")
+		}
+		key := data[pos : pos+keyLen]
+		pos += keyLen
+
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("truncated record set")
+		}
+		valLen := int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if pos+valLen > len(data) {
+			return nil, fmt.Errorf("truncated record set")
+		}
+		value := data[pos : pos+valLen]
+		pos += valLen
+
+		records = append(records, logstore.LogEntry{Key: key, Payload: value})
+	}
+	return records, nil
+}
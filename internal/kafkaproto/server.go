@@ -0,0 +1,166 @@
+package kafkaproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"kafka-clone/internal/consumers"
+	"kafka-clone/internal/groups"
+	"kafka-clone/internal/producers"
+	"kafka-clone/internal/topics"
+)
+
+// maxRequestSize bounds a single request frame, guarding against a
+// malformed or hostile length prefix causing an unbounded allocation.
+const maxRequestSize = 100 * 1024 * 1024
+
+// Server speaks the native Kafka TCP protocol over a second listener,
+// alongside the gRPC one, so unmodified Sarama/librdkafka clients can talk
+// to this broker. It translates every request into a call against the
+// same registry/producer/consumer/coordinator the gRPC Handler uses.
+type Server struct {
+	registry    *topics.Registry
+	producer    *producers.Producer
+	consumer    *consumers.Consumer
+	coordinator *groups.Coordinator
+
+	// brokerHost/brokerPort are advertised in Metadata/FindCoordinator
+	// responses so clients know where to (re)connect.
+	brokerID   int32
+	brokerHost string
+	brokerPort int32
+}
+
+// NewServer wires up a Server. brokerHost/brokerPort are this gateway's own
+// advertised address, since Kafka clients use Metadata responses to learn
+// where to connect rather than being told out of band.
+func NewServer(registry *topics.Registry, producer *producers.Producer, consumer *consumers.Consumer, coordinator *groups.Coordinator, brokerHost string, brokerPort int32) *Server {
+	return &Server{
+		registry:    registry,
+		producer:    producer,
+		consumer:    consumer,
+		coordinator: coordinator,
+		brokerID:    0,
+		brokerHost:  brokerHost,
+		brokerPort:  brokerPort,
+	}
+}
+
+// Serve accepts connections on lis until it's closed, handling each on its
+// own goroutine.
+func (s *Server) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn reads requests from conn sequentially and writes responses in
+// the same order, which is all Kafka's wire protocol requires for a client
+// to pipeline: it may write several requests back-to-back without waiting
+// for a reply in between, since TCP buffers the writes, as long as
+// responses come back in the order requests were sent.
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		sizeBuf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, sizeBuf); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(sizeBuf)
+		if size > maxRequestSize {
+			log.Printf("kafkaproto: rejecting oversized request (%d bytes) from %s", size, conn.RemoteAddr())
+			return
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+
+		resp, err := s.dispatch(payload)
+		if err != nil {
+			log.Printf("kafkaproto: request from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		frame := make([]byte, 4, 4+len(resp))
+		binary.BigEndian.PutUint32(frame, uint32(len(resp)))
+		frame = append(frame, resp...)
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// requestHeader is the fixed header every Kafka request starts with:
+// api_key, api_version, correlation_id, then a nullable client_id.
+type requestHeader struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+}
+
+// dispatch decodes and handles one request, returning the bytes of its
+// response body (excluding the outer size prefix, which handleConn adds).
+func (s *Server) dispatch(payload []byte) (resp []byte, err error) {
+	r := newReader(payload)
+
+	var hdr requestHeader
+	if hdr.apiKey, err = r.int16(); err != nil {
+		return nil, fmt.Errorf("read api_key: %w", err)
+	}
+	if hdr.apiVersion, err = r.int16(); err != nil {
+		return nil, fmt.Errorf("read api_version: %w", err)
+	}
+	if hdr.correlationID, err = r.int32(); err != nil {
+		return nil, fmt.Errorf("read correlation_id: %w", err)
+	}
+	if hdr.clientID, err = r.string(); err != nil {
+		return nil, fmt.Errorf("read client_id: %w", err)
+	}
+
+	w := &writer{}
+	w.int32(hdr.correlationID)
+
+	switch hdr.apiKey {
+	case apiApiVersions:
+		s.handleAPIVersions(w)
+	case apiMetadata:
+		s.handleMetadata(r, w)
+	case apiCreateTopics:
+		s.handleCreateTopics(r, w)
+	case apiProduce:
+		s.handleProduce(r, w)
+	case apiFetch:
+		s.handleFetch(r, w)
+	case apiListOffsets:
+		s.handleListOffsets(r, w)
+	case apiFindCoordinator:
+		s.handleFindCoordinator(r, w)
+	case apiJoinGroup:
+		s.handleJoinGroup(r, w)
+	case apiSyncGroup:
+		s.handleSyncGroup(r, w)
+	case apiHeartbeat:
+		s.handleHeartbeat(r, w)
+	case apiLeaveGroup:
+		s.handleLeaveGroup(r, w)
+	case apiOffsetCommit:
+		s.handleOffsetCommit(r, w)
+	case apiOffsetFetch:
+		s.handleOffsetFetch(r, w)
+	default:
+		return nil, fmt.Errorf("unsupported api key %d", hdr.apiKey)
+	}
+
+	return w.bytesWritten(), nil
+}
@@ -0,0 +1,177 @@
+// Package kafkaproto implements enough of the native Kafka TCP wire
+// protocol for unmodified Sarama/librdkafka clients to produce, fetch, and
+// coordinate consumer groups against this broker, translating requests
+// into calls against the same internal/topics, internal/producers,
+// internal/consumers, and internal/groups APIs the gRPC Handler uses.
+//
+// Only the oldest (v0, or the earliest version with the fields this broker
+// needs) request/response schema is implemented per API, and the
+// "flexible" (tagged-field) encoding introduced for later versions is not
+// supported. A real broker negotiates up to whatever version both sides
+// support; this one advertises only v0 in ApiVersions, which is enough for
+// any client to fall back to, but newer clients defaulting to a higher
+// version should be configured to pin the broker's lowest understood one.
+//
+// The record_set bytes of Produce and Fetch use this broker's own simplified
+// record encoding, not Kafka's native RecordBatch format (see recordset.go),
+// so clients that decode native record batches cannot read or write
+// records through this gateway.
+package kafkaproto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// reader decodes the classic (non-flexible) Kafka primitive wire types from
+// a single in-memory request buffer.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func newReader(buf []byte) *reader {
+	return &reader{buf: buf}
+}
+
+func (r *reader) remaining() int {
+	return len(r.buf) - r.pos
+}
+
+func (r *reader) int8() (int8, error) {
+	if r.remaining() < 1 {
+		return 0, fmt.Errorf("truncated int8")
+	}
+	v := int8(r.buf[r.pos])
+	r.pos++
+	return v, nil
+}
+
+func (r *reader) int16() (int16, error) {
+	if r.remaining() < 2 {
+		return 0, fmt.Errorf("truncated int16")
+	}
+	v := int16(binary.BigEndian.Uint16(r.buf[r.pos:]))
+	r.pos += 2
+	return v, nil
+}
+
+func (r *reader) int32() (int32, error) {
+	if r.remaining() < 4 {
+		return 0, fmt.Errorf("truncated int32")
+	}
+	v := int32(binary.BigEndian.Uint32(r.buf[r.pos:]))
+	r.pos += 4
+	return v, nil
+}
+
+func (r *reader) int64() (int64, error) {
+	if r.remaining() < 8 {
+		return 0, fmt.Errorf("truncated int64")
+	}
+	v := int64(binary.BigEndian.Uint64(r.buf[r.pos:]))
+	r.pos += 8
+	return v, nil
+}
+
+// string decodes a nullable Kafka STRING: an int16 length (-1 for null)
+// followed by that many UTF-8 bytes.
+func (r *reader) string() (string, error) {
+	n, err := r.int16()
+	if err != nil {
+		return "", err
+	}
+	if n < 0 {
+		return "", nil
+	}
+	if r.remaining() < int(n) {
+		return "", fmt.Errorf("truncated string")
+	}
+	s := string(r.buf[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s, nil
+}
+
+// bytes decodes a nullable Kafka BYTES: an int32 length (-1 for null)
+// followed by that many raw bytes.
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.int32()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	if r.remaining() < int(n) {
+		return nil, fmt.Errorf("truncated bytes")
+	}
+	b := make([]byte, n)
+	copy(b, r.buf[r.pos:r.pos+int(n)])
+	r.pos += int(n)
+	return b, nil
+}
+
+// arrayLen decodes a Kafka ARRAY length prefix: an int32 count, -1 meaning
+// a null (treated the same as empty) array.
+func (r *reader) arrayLen() (int32, error) {
+	n, err := r.int32()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// writer encodes the classic Kafka primitive wire types into an in-memory
+// response buffer.
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) int8(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *writer) int16(v int16) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+}
+
+func (w *writer) int32(v int32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+}
+
+func (w *writer) int64(v int64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+}
+
+func (w *writer) string(s string) {
+	w.int16(int16(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *writer) nullableString(s string) {
+	if s == "" {
+		w.int16(-1)
+		return
+	}
+	w.string(s)
+}
+
+func (w *writer) bytes(b []byte) {
+	if b == nil {
+		w.int32(-1)
+		return
+	}
+	w.int32(int32(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *writer) arrayLen(n int) {
+	w.int32(int32(n))
+}
+
+func (w *writer) bytesWritten() []byte {
+	return w.buf
+}
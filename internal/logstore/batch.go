@@ -0,0 +1,156 @@
+package logstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"kafka-clone/internal/compression"
+)
+
+// RecordVersionBatch marks an on-disk record as a compressed RecordBatch
+// (see encodeBatch) rather than a single RecordVersionKeyed entry.
+// Segments freely mix both: small, infrequent writes (e.g. consumer offset
+// commits via Partition.Append) still use the keyed format, while
+// Partition.AppendBatch produces RecordVersionBatch records for
+// high-throughput producers.
+const RecordVersionBatch byte = 2
+
+// RecordBatch is a contiguous range of offsets produced and compressed
+// together. Records is compressed as one unit with Codec, the same
+// batching tradeoff Kafka's own producer makes: fewer, larger writes in
+// exchange for having to decompress a whole batch to read any single
+// record in it.
+type RecordBatch struct {
+	BaseOffset int64
+	Codec      compression.Codec
+	Records    []LogEntry
+}
+
+// encodeBatch serializes batch as:
+// [version byte][baseOffset int64][recordCount int32][codec byte][compressedLen int32][crc32][compressedRecords]
+// where compressedRecords decompresses to each record's
+// [keyLen int32][key][valueLen int32][value] concatenated in order. The
+// CRC covers the compressed bytes, since those are what a torn write would
+// corrupt.
+func encodeBatch(batch RecordBatch) ([]byte, error) {
+	inner := make([]byte, 0, 64*len(batch.Records))
+	for _, rec := range batch.Records {
+		inner = binary.BigEndian.AppendUint32(inner, uint32(len(rec.Key)))
+		inner = append(inner, rec.Key...)
+		inner = binary.BigEndian.AppendUint32(inner, uint32(len(rec.Payload)))
+		inner = append(inner, rec.Payload...)
+	}
+
+	codec, err := compression.Get(batch.Codec)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := codec.Encode(inner)
+	if err != nil {
+		return nil, fmt.Errorf("compress batch at offset %d: %w", batch.BaseOffset, err)
+	}
+
+	buf := make([]byte, 0, 1+8+4+1+4+4+len(compressed))
+	buf = append(buf, RecordVersionBatch)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(batch.BaseOffset))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(batch.Records)))
+	buf = append(buf, byte(batch.Codec))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(compressed)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(compressed))
+	buf = append(buf, compressed...)
+	return buf, nil
+}
+
+// readBatchBody reads a batch record's body - everything after the version
+// byte, which the caller has already consumed - and expands it back into
+// individual LogEntrys with their assigned offsets. Like readKeyedBody, it
+// returns (nil, n, nil) rather than an error if the CRC doesn't match,
+// since that's treated as the end of valid data, not corruption to fail on.
+func readBatchBody(r io.Reader) ([]*LogEntry, int64, error) {
+	var n int64
+
+	var baseOffset int64
+	if err := binary.Read(r, binary.BigEndian, &baseOffset); err != nil {
+		return nil, n, err
+	}
+	n += 8
+
+	var recordCount uint32
+	if err := binary.Read(r, binary.BigEndian, &recordCount); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	codecByte := make([]byte, 1)
+	if _, err := io.ReadFull(r, codecByte); err != nil {
+		return nil, n, err
+	}
+	n++
+
+	var compressedLen uint32
+	if err := binary.Read(r, binary.BigEndian, &compressedLen); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	var crc uint32
+	if err := binary.Read(r, binary.BigEndian, &crc); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	compressed := make([]byte, compressedLen)
+	if _, err := io.ReadFull(r, compressed); err != nil {
+		return nil, n, err
+	}
+	n += int64(compressedLen)
+
+	if crc32.ChecksumIEEE(compressed) != crc {
+		return nil, n, nil
+	}
+
+	codec, err := compression.Get(compression.Codec(codecByte[0]))
+	if err != nil {
+		return nil, n, err
+	}
+	inner, err := codec.Decode(compressed)
+	if err != nil {
+		return nil, n, fmt.Errorf("decompress batch at offset %d: %w", baseOffset, err)
+	}
+
+	entries := make([]*LogEntry, 0, recordCount)
+	pos := 0
+	for i := uint32(0); i < recordCount; i++ {
+		if pos+4 > len(inner) {
+			return nil, n, fmt.Errorf("truncated batch at offset %d", baseOffset)
+		}
+		keyLen := int(binary.BigEndian.Uint32(inner[pos : pos+4]))
+		pos += 4
+		if pos+keyLen > len(inner) {
+			return nil, n, fmt.Errorf("truncated batch at offset %d", baseOffset)
+		}
+		key := inner[pos : pos+keyLen]
+		pos += keyLen
+
+		if pos+4 > len(inner) {
+			return nil, n, fmt.Errorf("truncated batch at offset %d", baseOffset)
+		}
+		valueLen := int(binary.BigEndian.Uint32(inner[pos : pos+4]))
+		pos += 4
+		if pos+valueLen > len(inner) {
+			return nil, n, fmt.Errorf("truncated batch at offset %d", baseOffset)
+		}
+		value := inner[pos : pos+valueLen]
+		pos += valueLen
+
+		entries = append(entries, &LogEntry{
+			Offset:  baseOffset + int64(i),
+			Key:     key,
+			Payload: value,
+		})
+	}
+
+	return entries, n, nil
+}
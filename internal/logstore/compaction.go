@@ -0,0 +1,91 @@
+package logstore
+
+import "fmt"
+
+// Compact rewrites every closed (non-active) segment of the partition,
+// keeping only the latest record per key. It is a no-op unless the
+// partition's CleanupPolicy is CleanupCompact. The active segment is never
+// touched, since it's still being appended to.
+//
+// Compaction happens in two passes: first it scans every closed segment to
+// build a single offset map of each key's latest occurrence across the
+// whole partition, then it rewrites each segment keeping only the entries
+// that map agrees are still the latest for their key (plus any entry with
+// no key, which compaction never removes).
+func (p *Partition) Compact() error {
+	closed, dir := p.closedSegments()
+	if len(closed) == 0 {
+		return nil
+	}
+
+	latest := make(map[string]int64)
+	for _, seg := range closed {
+		err := seg.ForEach(func(entry *LogEntry) error {
+			if len(entry.Key) == 0 {
+				return nil
+			}
+			key := string(entry.Key)
+			if cur, ok := latest[key]; !ok || entry.Offset > cur {
+				latest[key] = entry.Offset
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scan segment %d for compaction: %w", seg.BaseOffset(), err)
+		}
+	}
+
+	for _, seg := range closed {
+		baseOffset := seg.BaseOffset()
+		rewritten, err := RewriteSegment(dir, baseOffset, seg, func(entry *LogEntry) bool {
+			if len(entry.Key) == 0 {
+				return true
+			}
+			return latest[string(entry.Key)] == entry.Offset
+		})
+		if err != nil {
+			return fmt.Errorf("rewrite segment %d: %w", baseOffset, err)
+		}
+
+		// Swap the rewritten segment in before closing seg, so that no
+		// Partition.Read/ReadBatch/ReadInto lookup can ever find seg
+		// still in p.segments after it's already closed (see
+		// RewriteSegment's doc comment). Any reader that grabbed seg just
+		// before the swap is unaffected: Segment.Close takes seg's own
+		// lock, so it simply waits for that read to finish.
+		p.replaceSegment(baseOffset, rewritten)
+
+		if err := seg.Close(); err != nil {
+			return fmt.Errorf("close replaced segment %d: %w", baseOffset, err)
+		}
+	}
+
+	return nil
+}
+
+// closedSegments returns a snapshot of every segment except the active
+// (last) one, which compaction must never rewrite out from under a writer.
+func (p *Partition) closedSegments() ([]*Segment, string) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.retention.CleanupPolicy != CleanupCompact || len(p.segments) < 2 {
+		return nil, ""
+	}
+
+	closed := make([]*Segment, len(p.segments)-1)
+	copy(closed, p.segments[:len(p.segments)-1])
+	return closed, p.dir
+}
+
+func (p *Partition) replaceSegment(baseOffset int64, rewritten *Segment) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, s := range p.segments {
+		if s.BaseOffset() == baseOffset {
+			p.segments[i] = rewritten
+			return
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package logstore
+
+import (
+	"io"
+	"os"
+)
+
+// mmapIndex falls back to a one-shot read of the whole index file on
+// platforms without mmap support. It's still safe for concurrent readers
+// since every refresh (see Segment.remapIndex) produces a brand new,
+// never-mutated-in-place slice rather than writing into a shared buffer.
+func mmapIndex(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func munmapIndex(data []byte) error {
+	return nil
+}
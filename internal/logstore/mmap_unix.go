@@ -0,0 +1,25 @@
+//go:build unix
+
+package logstore
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapIndex maps f's first size bytes into memory so findPosition can read
+// index entries without a seek+read syscall per lookup.
+func mmapIndex(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+func munmapIndex(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return unix.Munmap(data)
+}
@@ -2,23 +2,68 @@ package logstore
 
 import (
 	"fmt"
+	"io"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"kafka-clone/internal/compression"
+)
+
+// CleanupPolicy selects how a partition reclaims disk space.
+type CleanupPolicy string
+
+const (
+	// CleanupDelete drops whole segments once they age out or the
+	// partition grows past its byte budget.
+	CleanupDelete CleanupPolicy = "delete"
+	// CleanupCompact keeps only the latest record per key, forever,
+	// instead of deleting by age or size.
+	CleanupCompact CleanupPolicy = "compact"
 )
 
+// RetentionConfig is a partition's retention/compaction policy. A negative
+// RetentionMs or RetentionBytes means "unlimited" for that dimension, the
+// same convention Kafka uses for -1.
+type RetentionConfig struct {
+	RetentionMs    int64
+	RetentionBytes int64
+	CleanupPolicy  CleanupPolicy
+}
+
+// DefaultRetentionConfig matches Kafka's broker defaults: delete segments
+// older than 7 days, no size cap.
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		RetentionMs:    7 * 24 * time.Hour.Milliseconds(),
+		RetentionBytes: -1,
+		CleanupPolicy:  CleanupDelete,
+	}
+}
+
 type Partition struct {
-	id       int32
-	dir      string
-	segments []*Segment
-	mutex    sync.RWMutex
+	id        int32
+	dir       string
+	segments  []*Segment
+	retention RetentionConfig
+
+	// flushMessages/flushIntervalMs are applied to every segment this
+	// partition creates; see Segment.SetFlushPolicy.
+	flushMessages   int64
+	flushIntervalMs int64
+
+	mutex sync.RWMutex
 }
 
 func NewPartition(dataDir string, topic string, id int32) (*Partition, error) {
 	dir := filepath.Join(dataDir, topic, fmt.Sprintf("partition%d", id))
 
 	p := &Partition{
-		id:  id,
-		dir: dir,
+		id:              id,
+		dir:             dir,
+		retention:       DefaultRetentionConfig(),
+		flushMessages:   FlushMessagesUnlimited,
+		flushIntervalMs: FlushIntervalUnlimited,
 	}
 
 	segments, err := LoadSegments(dir)
@@ -37,10 +82,45 @@ func NewPartition(dataDir string, topic string, id int32) (*Partition, error) {
 		p.segments = append(p.segments, segment)
 	}
 
+	for _, s := range p.segments {
+		s.SetFlushPolicy(p.flushMessages, p.flushIntervalMs)
+	}
+
 	return p, nil
 }
 
-func (p *Partition) Append(payload []byte) (int64, error) {
+// SetFlushPolicy updates how often this partition's segments force an
+// fsync (see Segment.SetFlushPolicy), applying it to every existing
+// segment and to any segment created afterwards.
+func (p *Partition) SetFlushPolicy(flushMessages, flushIntervalMs int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.flushMessages = flushMessages
+	p.flushIntervalMs = flushIntervalMs
+	for _, s := range p.segments {
+		s.SetFlushPolicy(flushMessages, flushIntervalMs)
+	}
+}
+
+// SetRetention updates the partition's retention/compaction policy. It
+// takes effect on the next call to ApplyRetention or Compact.
+func (p *Partition) SetRetention(cfg RetentionConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.retention = cfg
+}
+
+// Retention returns the partition's current retention/compaction policy.
+func (p *Partition) Retention() RetentionConfig {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.retention
+}
+
+// Append writes payload to the active segment, rolling to a new one if it's
+// full. key may be nil for topics that don't use log compaction.
+func (p *Partition) Append(key, payload []byte) (int64, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -53,11 +133,12 @@ func (p *Partition) Append(payload []byte) (int64, error) {
 		if err != nil {
 			return 0, err
 		}
+		newSegment.SetFlushPolicy(p.flushMessages, p.flushIntervalMs)
 		p.segments = append(p.segments, newSegment)
 		activeSegment = newSegment
 	}
 
-	entry := LogEntry{Payload: payload}
+	entry := LogEntry{Key: key, Payload: payload}
 	if err := activeSegment.Append(entry); err != nil {
 		return 0, err
 	}
@@ -65,6 +146,74 @@ func (p *Partition) Append(payload []byte) (int64, error) {
 	return entry.Offset, nil
 }
 
+// AppendBatch writes records to the active segment as a single compressed
+// batch, rolling to a new segment first if it's full, and returns the base
+// offset assigned to the batch.
+func (p *Partition) AppendBatch(codec compression.Codec, records []LogEntry) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	activeSegment := p.segments[len(p.segments)-1]
+
+	if activeSegment.Size() >= SegmentMaxBytes {
+		newBaseOffset := activeSegment.NextOffset()
+		newSegment, err := NewSegment(p.dir, newBaseOffset)
+		if err != nil {
+			return 0, err
+		}
+		newSegment.SetFlushPolicy(p.flushMessages, p.flushIntervalMs)
+		p.segments = append(p.segments, newSegment)
+		activeSegment = newSegment
+	}
+
+	return activeSegment.AppendBatch(RecordBatch{Codec: codec, Records: records})
+}
+
+// ReadBatch returns the whole batch the given offset belongs to; see
+// Segment.ReadBatch.
+func (p *Partition) ReadBatch(offset int64) (*RecordBatch, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, segment := range p.segments {
+		if offset >= segment.BaseOffset() && offset < segment.NextOffset() {
+			return segment.ReadBatch(offset)
+		}
+	}
+
+	return nil, fmt.Errorf("offset %d not found in partition %d", offset, p.id)
+}
+
+// ReadInto streams the raw bytes covering offset and beyond, up to
+// maxBytes, directly to w; see Segment.ReadInto.
+func (p *Partition) ReadInto(w io.Writer, offset, maxBytes int64) (int64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, segment := range p.segments {
+		if offset >= segment.BaseOffset() && offset < segment.NextOffset() {
+			return segment.ReadInto(w, offset, maxBytes)
+		}
+	}
+
+	return 0, fmt.Errorf("offset %d not found in partition %d", offset, p.id)
+}
+
+// RecordSetLen resolves the byte length ReadInto would stream for
+// offset/maxBytes, without transferring anything; see Segment.RecordSetLen.
+func (p *Partition) RecordSetLen(offset, maxBytes int64) (int64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, segment := range p.segments {
+		if offset >= segment.BaseOffset() && offset < segment.NextOffset() {
+			return segment.RecordSetLen(offset, maxBytes)
+		}
+	}
+
+	return 0, fmt.Errorf("offset %d not found in partition %d", offset, p.id)
+}
+
 func (p *Partition) Read(offset int64) (*LogEntry, error) {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
@@ -100,3 +249,124 @@ func (p *Partition) Close() error {
 
 	return nil
 }
+
+// ForEach calls fn with every valid record across all of the partition's
+// segments, in offset order, including the active segment; see
+// Segment.ForEach.
+func (p *Partition) ForEach(fn func(*LogEntry) error) error {
+	p.mutex.RLock()
+	segments := make([]*Segment, len(p.segments))
+	copy(segments, p.segments)
+	p.mutex.RUnlock()
+
+	for _, segment := range segments {
+		if err := segment.ForEach(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreFrom discards every record currently on disk and replaces it with
+// entries (which must be in ascending offset order, as ForEach produces
+// them), then advances the partition to nextOffset. It is used to rebuild a
+// partition from a Raft snapshot (see cluster.partitionFSM.Restore): the
+// local segment files may be stale or missing entirely on the restoring
+// node, so the snapshot's own records become the source of truth. Gaps
+// between consecutive entries' offsets (left by compaction having rewritten
+// away the offsets in between) and any gap between the last entry and
+// nextOffset are preserved rather than renumbered, so the rebuilt
+// partition's offset space matches the original exactly.
+func (p *Partition) RestoreFrom(entries []LogEntry, nextOffset int64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, segment := range p.segments {
+		if err := segment.Delete(); err != nil {
+			return err
+		}
+	}
+
+	segment, err := NewSegment(p.dir, 0)
+	if err != nil {
+		return err
+	}
+	segment.SetFlushPolicy(p.flushMessages, p.flushIntervalMs)
+	p.segments = []*Segment{segment}
+
+	for _, entry := range entries {
+		if err := segment.AppendAt(entry.Offset, entry.Key, entry.Payload); err != nil {
+			return err
+		}
+	}
+	if nextOffset > segment.NextOffset() {
+		if err := segment.SetNextOffset(nextOffset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyRetention deletes whole non-active segments that have aged past
+// RetentionMs, then deletes the oldest remaining non-active segments while
+// the partition's total size exceeds RetentionBytes. It is a no-op unless
+// CleanupPolicy is CleanupDelete.
+func (p *Partition) ApplyRetention() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.retention.CleanupPolicy != CleanupDelete {
+		return nil
+	}
+
+	if p.retention.RetentionMs >= 0 {
+		cutoff := time.Now().Add(-time.Duration(p.retention.RetentionMs) * time.Millisecond)
+		if err := p.deleteWhile(func(s *Segment) (bool, error) {
+			modTime, err := s.ModTime()
+			if err != nil {
+				return false, err
+			}
+			return modTime.Before(cutoff), nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if p.retention.RetentionBytes >= 0 {
+		if err := p.deleteWhile(func(*Segment) (bool, error) {
+			return p.totalSize() > p.retention.RetentionBytes, nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteWhile removes the oldest non-active segment as long as shouldDelete
+// returns true for it, always keeping at least the active segment.
+func (p *Partition) deleteWhile(shouldDelete func(*Segment) (bool, error)) error {
+	for len(p.segments) > 1 {
+		oldest := p.segments[0]
+		ok, err := shouldDelete(oldest)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err := oldest.Delete(); err != nil {
+			return err
+		}
+		p.segments = p.segments[1:]
+	}
+	return nil
+}
+
+func (p *Partition) totalSize() int64 {
+	var total int64
+	for _, s := range p.segments {
+		total += s.Size()
+	}
+	return total
+}
@@ -0,0 +1,93 @@
+package logstore
+
+import "testing"
+
+// TestPartitionRestoreFromPreservesGaps guards against a Raft snapshot
+// restore silently renumbering offsets: entries must land back at their
+// original offset, gaps included (the same gaps compaction leaves behind
+// when it rewrites away a superseded key), not get squashed into a
+// contiguous 0..N-1 range.
+func TestPartitionRestoreFromPreservesGaps(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPartition(dir, "t", 0)
+	if err != nil {
+		t.Fatalf("NewPartition: %v", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := p.Append(nil, []byte{byte(i)}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	var all []LogEntry
+	if err := p.ForEach(func(e *LogEntry) error {
+		all = append(all, *e)
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+
+	// Simulate compaction having rewritten away offset 2, the way
+	// RewriteSegment does: drop it from the surviving entries without
+	// renumbering anything after it.
+	var surviving []LogEntry
+	for _, e := range all {
+		if e.Offset == 2 {
+			continue
+		}
+		surviving = append(surviving, e)
+	}
+
+	if err := p.RestoreFrom(surviving, p.NextOffset()); err != nil {
+		t.Fatalf("RestoreFrom: %v", err)
+	}
+
+	if _, err := p.Read(2); err == nil {
+		t.Fatal("Read(2): want error for a gap, got nil")
+	}
+	for _, offset := range []int64{0, 1, 3, 4} {
+		entry, err := p.Read(offset)
+		if err != nil {
+			t.Fatalf("Read(%d): %v", offset, err)
+		}
+		if entry.Offset != offset {
+			t.Fatalf("Read(%d) returned entry for offset %d", offset, entry.Offset)
+		}
+	}
+	if p.NextOffset() != 5 {
+		t.Fatalf("NextOffset() = %d, want 5", p.NextOffset())
+	}
+}
+
+// TestPartitionRestoreFromTrailingGap guards against RestoreFrom leaving
+// NextOffset short when the tail of the offset space has no surviving
+// entry at all (e.g. the snapshot captured nextOffset after a record was
+// compacted away with nothing appended after it yet).
+func TestPartitionRestoreFromTrailingGap(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPartition(dir, "t", 0)
+	if err != nil {
+		t.Fatalf("NewPartition: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.RestoreFrom(nil, 3); err != nil {
+		t.Fatalf("RestoreFrom: %v", err)
+	}
+	if p.NextOffset() != 3 {
+		t.Fatalf("NextOffset() = %d, want 3", p.NextOffset())
+	}
+
+	if _, err := p.Append(nil, []byte("x")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	entry, err := p.Read(3)
+	if err != nil {
+		t.Fatalf("Read(3): %v", err)
+	}
+	if entry.Offset != 3 {
+		t.Fatalf("Append after restore landed at offset %d, want 3", entry.Offset)
+	}
+}
@@ -1,6 +1,7 @@
 package logstore
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
@@ -11,15 +12,38 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"kafka-clone/internal/compression"
 )
 
 const (
 	SegmentMaxBytes = 128 * 1024 * 1024 // 128 MB
 	IndexInterval   = 4096              // Index every 4KB
+
+	// RecordVersionKeyed marks a single keyed record; RecordVersionBatch
+	// (batch.go) marks a compressed batch. The leading version byte lets
+	// segments mix both and lets a future on-disk format change add a new
+	// version without breaking recovery of segments written by this one.
+	RecordVersionKeyed byte = 1
+
+	// indexEntrySize is the on-disk (and mmap'd) size of one IndexEntry:
+	// two big-endian int32 fields.
+	indexEntrySize = 8
+
+	// FlushMessagesUnlimited and FlushIntervalUnlimited disable forced
+	// fsyncs on that dimension, matching this package's original
+	// behavior of leaving durability to the OS page cache and only
+	// fsyncing at Close or segment rotation. Kafka's own
+	// flush.messages/flush.ms defaults make the same throughput-favoring
+	// trade-off.
+	FlushMessagesUnlimited int64 = 0
+	FlushIntervalUnlimited int64 = 0
 )
 
 type LogEntry struct {
 	Offset  int64
+	Key     []byte
 	Payload []byte
 }
 
@@ -29,13 +53,32 @@ type IndexEntry struct {
 }
 
 type Segment struct {
-	baseOffset   int64
-	logFile      *os.File
-	indexFile    *os.File
-	size         int64
-	nextOffset   int64
-	indexEntries []IndexEntry
-	mutex        sync.RWMutex
+	baseOffset int64
+	dir        string
+	logFile    *os.File
+	indexFile  *os.File
+	size       int64
+	nextOffset int64
+	mutex      sync.RWMutex
+
+	// indexMmap is the index file's contents mapped into memory (see
+	// remapIndex); findPosition binary-searches it directly instead of
+	// seeking and reading the file on every lookup.
+	indexMmap []byte
+
+	// bufWriter coalesces Append/AppendBatch's record bytes before they
+	// hit the log file; writePos tracks the logical end of the file
+	// including whatever's still sitting in bufWriter, since Stat/Seek
+	// can't see unflushed bytes.
+	bufWriter *bufio.Writer
+	writePos  int64
+
+	// flushMessages/flushInterval configure how often Append forces an
+	// fsync; see SetFlushPolicy.
+	flushMessages     int64
+	flushInterval     time.Duration
+	unflushedMessages int64
+	lastFlush         time.Time
 }
 
 func NewSegment(dir string, baseOffset int64) (*Segment, error) {
@@ -43,15 +86,12 @@ func NewSegment(dir string, baseOffset int64) (*Segment, error) {
 		return nil, err
 	}
 
-	logPath := filepath.Join(dir, fmt.Sprintf("%020d.log", baseOffset))
-	indexPath := filepath.Join(dir, fmt.Sprintf("%020d.index", baseOffset))
-
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	logFile, err := os.OpenFile(logPath(dir, baseOffset), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, err
 	}
 
-	indexFile, err := os.OpenFile(indexPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	indexFile, err := os.OpenFile(indexPath(dir, baseOffset), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	if err != nil {
 		logFile.Close()
 		return nil, err
@@ -65,11 +105,17 @@ func NewSegment(dir string, baseOffset int64) (*Segment, error) {
 	}
 
 	segment := &Segment{
-		baseOffset: baseOffset,
-		logFile:    logFile,
-		indexFile:  indexFile,
-		size:       stat.Size(),
-		nextOffset: baseOffset,
+		baseOffset:    baseOffset,
+		dir:           dir,
+		logFile:       logFile,
+		indexFile:     indexFile,
+		size:          stat.Size(),
+		nextOffset:    baseOffset,
+		writePos:      stat.Size(),
+		bufWriter:     bufio.NewWriter(logFile),
+		flushMessages: FlushMessagesUnlimited,
+		flushInterval: 0,
+		lastFlush:     time.Now(),
 	}
 
 	if err := segment.recover(); err != nil {
@@ -80,24 +126,70 @@ func NewSegment(dir string, baseOffset int64) (*Segment, error) {
 	return segment, nil
 }
 
+// SetFlushPolicy configures how often Append/AppendBatch force an fsync:
+// after every flushMessages records, or after flushIntervalMs milliseconds
+// since the last fsync, whichever comes first. A value of 0 disables that
+// dimension; FlushMessagesUnlimited/FlushIntervalUnlimited name that
+// explicitly. Every write is still handed to the OS immediately regardless
+// of this policy - only the more expensive disk-durability fsync is
+// deferred.
+func (s *Segment) SetFlushPolicy(flushMessages, flushIntervalMs int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushMessages = flushMessages
+	s.flushInterval = time.Duration(flushIntervalMs) * time.Millisecond
+}
+
+func logPath(dir string, baseOffset int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d.log", baseOffset))
+}
+
+func indexPath(dir string, baseOffset int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d.index", baseOffset))
+}
+
+// remapIndex refreshes indexMmap to cover the index file's current
+// contents. It must be called once at startup and again every time the
+// index file grows, so findPosition always sees every entry written so far
+// without issuing a read syscall per lookup.
+func (s *Segment) remapIndex() error {
+	if err := munmapIndex(s.indexMmap); err != nil {
+		return err
+	}
+
+	stat, err := s.indexFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	data, err := mmapIndex(s.indexFile, stat.Size())
+	if err != nil {
+		return err
+	}
+	s.indexMmap = data
+	return nil
+}
+
+// indexEntryCount returns how many IndexEntry records are currently mapped.
+func (s *Segment) indexEntryCount() int {
+	return len(s.indexMmap) / indexEntrySize
+}
+
+// indexEntryAt decodes the i'th IndexEntry directly out of indexMmap.
+func (s *Segment) indexEntryAt(i int) IndexEntry {
+	b := s.indexMmap[i*indexEntrySize:]
+	return IndexEntry{
+		RelativeOffset: int32(binary.BigEndian.Uint32(b)),
+		Position:       int32(binary.BigEndian.Uint32(b[4:])),
+	}
+}
+
 func (s *Segment) recover() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	// Load index entries
-	s.indexFile.Seek(0, io.SeekStart)
-	for {
-		var entry IndexEntry
-		if err := binary.Read(s.indexFile, binary.BigEndian, &entry.RelativeOffset); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		if err := binary.Read(s.indexFile, binary.BigEndian, &entry.Position); err != nil {
-			return err
-		}
-		s.indexEntries = append(s.indexEntries, entry)
+	if err := s.remapIndex(); err != nil {
+		return err
 	}
 
 	// Scan log file to find next offset
@@ -105,40 +197,22 @@ func (s *Segment) recover() error {
 	var position int64
 
 	for {
-		var offset int64
-		var length int32
-		var crc uint32
-
-		if err := binary.Read(s.logFile, binary.BigEndian, &offset); err != nil {
+		entries, n, err := readRecord(s.logFile)
+		if err != nil {
 			if err == io.EOF {
 				break
 			}
 			return err
 		}
-
-		if err := binary.Read(s.logFile, binary.BigEndian, &length); err != nil {
-			return err
-		}
-
-		if err := binary.Read(s.logFile, binary.BigEndian, &crc); err != nil {
-			return err
-		}
-
-		payload := make([]byte, length)
-		if _, err := io.ReadFull(s.logFile, payload); err != nil {
-			return err
-		}
-
-		// Verify CRC
-		expectedCRC := crc32.ChecksumIEEE(payload)
-		if crc != expectedCRC {
-			// Truncate at this position to remove corrupted entry
+		if entries == nil {
+			// Corrupt record (bad CRC); truncate at this position and stop
+			// replaying, the same recovery behavior as before.
 			s.logFile.Truncate(position)
 			break
 		}
 
-		s.nextOffset = offset + 1
-		position, _ = s.logFile.Seek(0, io.SeekCurrent)
+		s.nextOffset = entries[len(entries)-1].Offset + 1
+		position += n
 	}
 
 	return nil
@@ -149,53 +223,158 @@ func (s *Segment) Append(entry LogEntry) error {
 	defer s.mutex.Unlock()
 
 	entry.Offset = s.nextOffset
+	position := s.writePos
 
-	// Calculate CRC
-	crc := crc32.ChecksumIEEE(entry.Payload)
+	record := encodeRecord(entry)
+	if _, err := s.bufWriter.Write(record); err != nil {
+		return err
+	}
+	s.writePos += int64(len(record))
+	s.size = s.writePos
 
-	// Write: [offset][length][crc][payload]
-	position, _ := s.logFile.Seek(0, io.SeekEnd)
+	if err := s.afterWrite(); err != nil {
+		return err
+	}
 
-	if err := binary.Write(s.logFile, binary.BigEndian, entry.Offset); err != nil {
+	if err := s.maybeIndex(position, entry.Offset); err != nil {
 		return err
 	}
 
-	if err := binary.Write(s.logFile, binary.BigEndian, int32(len(entry.Payload))); err != nil {
+	s.nextOffset++
+	return nil
+}
+
+// AppendAt writes a single entry at an already-known offset, used only to
+// rebuild a segment from a Raft snapshot (see cluster.partitionFSM.Restore).
+// offset must be >= the segment's current next offset; any gap between
+// them - left by compaction having rewritten away the offsets in between -
+// is skipped over without writing anything, so the rebuilt segment's
+// offset space lines up with the original exactly, gaps included.
+func (s *Segment) AppendAt(offset int64, key, payload []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if offset < s.nextOffset {
+		return fmt.Errorf("AppendAt offset %d is behind segment's next offset %d", offset, s.nextOffset)
+	}
+
+	entry := LogEntry{Offset: offset, Key: key, Payload: payload}
+	position := s.writePos
+
+	record := encodeRecord(entry)
+	if _, err := s.bufWriter.Write(record); err != nil {
 		return err
 	}
+	s.writePos += int64(len(record))
+	s.size = s.writePos
 
-	if err := binary.Write(s.logFile, binary.BigEndian, crc); err != nil {
+	if err := s.afterWrite(); err != nil {
 		return err
 	}
 
-	if _, err := s.logFile.Write(entry.Payload); err != nil {
+	if err := s.maybeIndex(position, offset); err != nil {
 		return err
 	}
 
-	s.size = position + 8 + 4 + 4 + int64(len(entry.Payload))
+	s.nextOffset = offset + 1
+	return nil
+}
 
-	// Update index if needed
-	if len(s.indexEntries) == 0 || position-int64(s.indexEntries[len(s.indexEntries)-1].Position) >= IndexInterval {
-		indexEntry := IndexEntry{
-			RelativeOffset: int32(entry.Offset - s.baseOffset),
-			Position:       int32(position),
-		}
+// SetNextOffset advances the segment's next offset to offset without
+// writing a record, used once restoring a snapshot has replayed every
+// surviving record: if the tail of the original offset space was itself
+// compacted/trimmed away, AppendAt alone would leave the rebuilt segment's
+// next offset short of the original partition's.
+func (s *Segment) SetNextOffset(offset int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-		if err := binary.Write(s.indexFile, binary.BigEndian, indexEntry.RelativeOffset); err != nil {
-			return err
-		}
+	if offset < s.nextOffset {
+		return fmt.Errorf("SetNextOffset %d is behind segment's next offset %d", offset, s.nextOffset)
+	}
+	s.nextOffset = offset
+	return nil
+}
 
-		if err := binary.Write(s.indexFile, binary.BigEndian, indexEntry.Position); err != nil {
-			return err
-		}
+// afterWrite flushes bufWriter so the bytes just written are immediately
+// visible to anything reading the log file directly (Read, ForEach,
+// recover), then forces an fsync to disk if the segment's flush.messages
+// or flush.ms policy says it's time.
+func (s *Segment) afterWrite() error {
+	if err := s.bufWriter.Flush(); err != nil {
+		return err
+	}
 
-		s.indexEntries = append(s.indexEntries, indexEntry)
+	s.unflushedMessages++
+	due := (s.flushMessages > 0 && s.unflushedMessages >= s.flushMessages) ||
+		(s.flushInterval > 0 && time.Since(s.lastFlush) >= s.flushInterval)
+	if !due {
+		return nil
 	}
 
-	s.nextOffset++
+	if err := s.logFile.Sync(); err != nil {
+		return err
+	}
+	s.unflushedMessages = 0
+	s.lastFlush = time.Now()
 	return nil
 }
 
+// maybeIndex appends a new index entry for a record at position/offset if
+// the segment has grown past IndexInterval bytes since the last one, then
+// remaps indexMmap so the new entry is visible to findPosition.
+func (s *Segment) maybeIndex(position, offset int64) error {
+	n := s.indexEntryCount()
+	if n > 0 && position-int64(s.indexEntryAt(n-1).Position) < IndexInterval {
+		return nil
+	}
+
+	indexEntry := IndexEntry{
+		RelativeOffset: int32(offset - s.baseOffset),
+		Position:       int32(position),
+	}
+	if err := binary.Write(s.indexFile, binary.BigEndian, indexEntry.RelativeOffset); err != nil {
+		return err
+	}
+	if err := binary.Write(s.indexFile, binary.BigEndian, indexEntry.Position); err != nil {
+		return err
+	}
+
+	return s.remapIndex()
+}
+
+// AppendBatch writes batch as a single compressed on-disk record, assigning
+// it a contiguous range of offsets starting at the segment's next offset.
+// It returns that base offset.
+func (s *Segment) AppendBatch(batch RecordBatch) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch.BaseOffset = s.nextOffset
+	position := s.writePos
+
+	record, err := encodeBatch(batch)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.bufWriter.Write(record); err != nil {
+		return 0, err
+	}
+	s.writePos += int64(len(record))
+	s.size = s.writePos
+
+	if err := s.afterWrite(); err != nil {
+		return 0, err
+	}
+
+	if err := s.maybeIndex(position, batch.BaseOffset); err != nil {
+		return 0, err
+	}
+
+	s.nextOffset += int64(len(batch.Records))
+	return batch.BaseOffset, nil
+}
+
 func (s *Segment) Read(offset int64) (*LogEntry, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -205,54 +384,268 @@ func (s *Segment) Read(offset int64) (*LogEntry, error) {
 	}
 
 	position := s.findPosition(offset)
-	s.logFile.Seek(position, io.SeekStart)
+	// io.NewSectionReader wraps ReadAt and tracks its own read cursor
+	// independently of s.logFile's shared position, so concurrent Read/
+	// ReadBatch/ReadInto calls at different offsets don't race on a Seek
+	// landing between another call's sequential reads.
+	r := io.NewSectionReader(s.logFile, position, s.size-position)
 
-	// Scan from position to find exact offset
+	// Scan from position to find the record (or batch) containing offset
 	for {
-		var entryOffset int64
-		var length int32
-		var crc uint32
-
-		if err := binary.Read(s.logFile, binary.BigEndian, &entryOffset); err != nil {
+		entries, _, err := readRecord(r)
+		if err != nil {
 			return nil, err
 		}
+		if entries == nil {
+			return nil, fmt.Errorf("corrupt record for offset %d", offset)
+		}
 
-		if err := binary.Read(s.logFile, binary.BigEndian, &length); err != nil {
-			return nil, err
+		if offset >= entries[0].Offset && offset <= entries[len(entries)-1].Offset {
+			return entries[offset-entries[0].Offset], nil
 		}
 
-		if err := binary.Read(s.logFile, binary.BigEndian, &crc); err != nil {
-			return nil, err
+		if entries[0].Offset > offset {
+			return nil, fmt.Errorf("offset %d not found", offset)
 		}
+	}
+}
 
-		payload := make([]byte, length)
-		if _, err := io.ReadFull(s.logFile, payload); err != nil {
+// ReadBatch works like Read but returns the whole batch an offset belongs
+// to, decompressed, rather than a single record. Since the records are
+// already decompressed, the returned Codec is always compression.None. A
+// non-batch (keyed) record is reported as a single-element batch, so callers
+// like the Kafka-protocol Fetch path can treat every record uniformly.
+func (s *Segment) ReadBatch(offset int64) (*RecordBatch, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if offset < s.baseOffset || offset >= s.nextOffset {
+		return nil, fmt.Errorf("offset %d out of range [%d, %d)", offset, s.baseOffset, s.nextOffset)
+	}
+
+	position := s.findPosition(offset)
+	r := io.NewSectionReader(s.logFile, position, s.size-position)
+
+	for {
+		entries, _, err := readRecord(r)
+		if err != nil {
 			return nil, err
 		}
+		if entries == nil {
+			return nil, fmt.Errorf("corrupt record for offset %d", offset)
+		}
 
-		if entryOffset == offset {
-			return &LogEntry{Offset: entryOffset, Payload: payload}, nil
+		if offset >= entries[0].Offset && offset <= entries[len(entries)-1].Offset {
+			records := make([]LogEntry, len(entries))
+			for i, e := range entries {
+				records[i] = *e
+			}
+			return &RecordBatch{BaseOffset: entries[0].Offset, Codec: compression.None, Records: records}, nil
 		}
 
-		if entryOffset > offset {
+		if entries[0].Offset > offset {
 			return nil, fmt.Errorf("offset %d not found", offset)
 		}
 	}
 }
 
+// ReadInto streams the raw on-disk bytes of the record containing offset,
+// plus any whole records immediately following it, up to maxBytes total,
+// directly to w - see sendRange (sendfile_linux.go/sendfile_other.go) for
+// how that transfer avoids copying through a Go-managed buffer when w is a
+// *net.TCPConn. Like ConsumeBatch, it never splits a record to stay under
+// maxBytes, so it always returns at least one record's worth of bytes.
+func (s *Segment) ReadInto(w io.Writer, offset, maxBytes int64) (int64, error) {
+	s.mutex.RLock()
+	start, end, err := s.byteRange(offset, maxBytes)
+	s.mutex.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	return sendRange(w, s.logFile, start, end-start)
+}
+
+// byteRange resolves the [start, end) byte range in the log file that
+// covers the record containing offset and every whole record after it
+// until end-start would reach maxBytes.
+func (s *Segment) byteRange(offset, maxBytes int64) (start, end int64, err error) {
+	if offset < s.baseOffset || offset >= s.nextOffset {
+		return 0, 0, fmt.Errorf("offset %d out of range [%d, %d)", offset, s.baseOffset, s.nextOffset)
+	}
+
+	start = s.findPosition(offset)
+	r := io.NewSectionReader(s.logFile, start, s.size-start)
+
+	position := start
+	found := false
+	for position < s.size {
+		entries, n, err := readRecord(r)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, 0, err
+		}
+		if entries == nil {
+			break
+		}
+
+		recordEnd := position + n
+		if entries[len(entries)-1].Offset >= offset {
+			if !found {
+				// Skip records between the index entry and the one
+				// containing offset.
+				start = position
+				found = true
+			}
+			end = recordEnd
+			if end-start >= maxBytes {
+				break
+			}
+		}
+		position = recordEnd
+	}
+
+	if !found {
+		return 0, 0, fmt.Errorf("offset %d not found", offset)
+	}
+	return start, end, nil
+}
+
+// RecordSetLen resolves the same [start, end) byte range ReadInto would
+// stream for offset/maxBytes, without transferring anything, so a caller
+// that must write a length prefix before the payload (e.g. the Kafka
+// protocol's BYTES framing) can learn the length first.
+func (s *Segment) RecordSetLen(offset, maxBytes int64) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	start, end, err := s.byteRange(offset, maxBytes)
+	if err != nil {
+		return 0, err
+	}
+	return end - start, nil
+}
+
 func (s *Segment) findPosition(offset int64) int64 {
 	relativeOffset := int32(offset - s.baseOffset)
 
-	// Binary search in index
-	idx := sort.Search(len(s.indexEntries), func(i int) bool {
-		return s.indexEntries[i].RelativeOffset > relativeOffset
+	// Binary search directly over the mmap'd index - no read syscall.
+	n := s.indexEntryCount()
+	idx := sort.Search(n, func(i int) bool {
+		return s.indexEntryAt(i).RelativeOffset > relativeOffset
 	})
 
 	if idx == 0 {
 		return 0
 	}
 
-	return int64(s.indexEntries[idx-1].Position)
+	return int64(s.indexEntryAt(idx - 1).Position)
+}
+
+// encodeRecord serializes entry as:
+// [version byte][offset int64][keyLen int32][key][valueLen int32][crc32][value]
+// The CRC covers the value only, matching what earlier segment versions
+// already protected.
+func encodeRecord(entry LogEntry) []byte {
+	crc := crc32.ChecksumIEEE(entry.Payload)
+
+	buf := make([]byte, 0, 1+8+4+len(entry.Key)+4+4+len(entry.Payload))
+	buf = append(buf, RecordVersionKeyed)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(entry.Offset))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Key)))
+	buf = append(buf, entry.Key...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc)
+	buf = append(buf, entry.Payload...)
+	return buf
+}
+
+// readRecord reads one on-disk record from r, dispatching on its leading
+// version byte, and returns every LogEntry it expands to - one for a
+// RecordVersionKeyed record, possibly many for a RecordVersionBatch one.
+// It returns (nil, n, nil), not an error, if the record's CRC doesn't
+// match, which callers treat as the end of valid data (e.g. a torn write
+// from a crash) rather than a hard failure.
+func readRecord(r io.Reader) ([]*LogEntry, int64, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	switch header[0] {
+	case RecordVersionKeyed:
+		entry, n, err := readKeyedBody(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry == nil {
+			return nil, 1 + n, nil
+		}
+		return []*LogEntry{entry}, 1 + n, nil
+	case RecordVersionBatch:
+		entries, n, err := readBatchBody(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entries == nil {
+			return nil, 1 + n, nil
+		}
+		return entries, 1 + n, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported record version %d", header[0])
+	}
+}
+
+// readKeyedBody reads a RecordVersionKeyed record's body - everything
+// after the version byte, which the caller has already consumed.
+func readKeyedBody(r io.Reader) (*LogEntry, int64, error) {
+	var n int64
+
+	var offset int64
+	if err := binary.Read(r, binary.BigEndian, &offset); err != nil {
+		return nil, n, err
+	}
+	n += 8
+
+	var keyLen uint32
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	key := make([]byte, keyLen)
+	if keyLen > 0 {
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, n, err
+		}
+	}
+	n += int64(keyLen)
+
+	var valueLen uint32
+	if err := binary.Read(r, binary.BigEndian, &valueLen); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	var crc uint32
+	if err := binary.Read(r, binary.BigEndian, &crc); err != nil {
+		return nil, n, err
+	}
+	n += 4
+
+	value := make([]byte, valueLen)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, n, err
+	}
+	n += int64(valueLen)
+
+	if crc32.ChecksumIEEE(value) != crc {
+		return nil, n, nil
+	}
+
+	return &LogEntry{Offset: offset, Key: key, Payload: value}, n, nil
 }
 
 func (s *Segment) Size() int64 {
@@ -271,17 +664,159 @@ func (s *Segment) NextOffset() int64 {
 	return s.nextOffset
 }
 
+// ForEach calls fn with every valid record in the segment, in offset order;
+// a batch record is expanded into its individual entries first. It stops
+// (without error) at the first corrupt record, the same recovery boundary
+// used elsewhere in this package.
+func (s *Segment) ForEach(fn func(*LogEntry) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, err := s.logFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	for {
+		entries, _, err := readRecord(s.logFile)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if entries == nil {
+			return nil
+		}
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RewriteSegment rewrites src's records into a new segment at the same
+// baseOffset, keeping only those for which keep returns true, then
+// atomically renames the new log/index files in over the old ones. src is
+// left open: renaming its underlying path out from under it doesn't
+// affect its already-open file descriptor or mmap, so it keeps reading
+// correctly until the caller is done with it. The caller must swap the
+// returned Segment into place first and only close src afterwards, so
+// that no reader can observe src already closed while it's still the
+// segment a lookup would find. Any RecordVersionBatch records in src are
+// flattened into individual RecordVersionKeyed records in the rewrite,
+// since compaction/retention operate per key rather than per batch.
+func RewriteSegment(dir string, baseOffset int64, src *Segment, keep func(*LogEntry) bool) (*Segment, error) {
+	tmpLog := logPath(dir, baseOffset) + ".compact"
+	tmpIndex := indexPath(dir, baseOffset) + ".compact"
+
+	logFile, err := os.OpenFile(tmpLog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	indexFile, err := os.OpenFile(tmpIndex, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	var position int64
+	var lastIndexed int64 = -1
+	writeErr := src.ForEach(func(entry *LogEntry) error {
+		if !keep(entry) {
+			return nil
+		}
+
+		record := encodeRecord(*entry)
+		if _, err := logFile.Write(record); err != nil {
+			return err
+		}
+
+		if lastIndexed < 0 || position-lastIndexed >= IndexInterval {
+			if err := binary.Write(indexFile, binary.BigEndian, int32(entry.Offset-baseOffset)); err != nil {
+				return err
+			}
+			if err := binary.Write(indexFile, binary.BigEndian, int32(position)); err != nil {
+				return err
+			}
+			lastIndexed = position
+		}
+
+		position += int64(len(record))
+		return nil
+	})
+
+	logFile.Sync()
+	logFile.Close()
+	indexFile.Sync()
+	indexFile.Close()
+
+	if writeErr != nil {
+		os.Remove(tmpLog)
+		os.Remove(tmpIndex)
+		return nil, writeErr
+	}
+
+	if err := os.Rename(tmpLog, logPath(dir, baseOffset)); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpIndex, indexPath(dir, baseOffset)); err != nil {
+		return nil, err
+	}
+
+	return NewSegment(dir, baseOffset)
+}
+
+// ModTime returns the log file's last-modified time, used by time-based
+// retention to decide whether a whole segment has aged out.
+func (s *Segment) ModTime() (time.Time, error) {
+	stat, err := s.logFile.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return stat.ModTime(), nil
+}
+
+// Delete closes and removes the segment's log and index files from disk.
+// It must only be called on a segment that is no longer the active
+// (appendable) segment of its partition.
+func (s *Segment) Delete() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.logFile != nil {
+		s.bufWriter.Flush()
+		s.logFile.Close()
+	}
+	if s.indexFile != nil {
+		munmapIndex(s.indexMmap)
+		s.indexMmap = nil
+		s.indexFile.Close()
+	}
+
+	if err := os.Remove(logPath(s.dir, s.baseOffset)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(indexPath(s.dir, s.baseOffset)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *Segment) Close() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	if s.logFile != nil {
+		s.bufWriter.Flush()
 		s.logFile.Sync()
 		s.logFile.Close()
 	}
 
 	if s.indexFile != nil {
 		s.indexFile.Sync()
+		munmapIndex(s.indexMmap)
+		s.indexMmap = nil
 		s.indexFile.Close()
 	}
 
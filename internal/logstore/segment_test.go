@@ -0,0 +1,80 @@
+package logstore
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestSegmentConcurrentReadsDoNotRace guards against Read/ReadBatch/ReadInto
+// racing on the shared *os.File's seek position: each used to Seek then
+// sequentially Read the same logFile handle under only an RLock, so one
+// goroutine's Seek could land between another's readRecord calls. Run with
+// -race, and check every read still gets back the payload it actually
+// asked for.
+func TestSegmentConcurrentReadsDoNotRace(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSegment(dir, 0)
+	if err != nil {
+		t.Fatalf("NewSegment: %v", err)
+	}
+	defer s.Close()
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		payload := []byte(fmt.Sprintf("payload-%d", i))
+		if err := s.Append(LogEntry{Payload: payload}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n*3)
+	for round := 0; round < 3; round++ {
+		for offset := int64(0); offset < n; offset++ {
+			offset := offset
+			want := fmt.Sprintf("payload-%d", offset)
+
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				entry, err := s.Read(offset)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if string(entry.Payload) != want {
+					errs <- fmt.Errorf("Read(%d) = %q, want %q", offset, entry.Payload, want)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				batch, err := s.ReadBatch(offset)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if string(batch.Records[0].Payload) != want {
+					errs <- fmt.Errorf("ReadBatch(%d) = %q, want %q", offset, batch.Records[0].Payload, want)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				var buf bytes.Buffer
+				if _, err := s.ReadInto(&buf, offset, 1<<20); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Contains(buf.Bytes(), []byte(want)) {
+					errs <- fmt.Errorf("ReadInto(%d) = %q, want it to contain %q", offset, buf.Bytes(), want)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package logstore
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendRange copies length bytes starting at offset from f to w. When w is a
+// raw TCP connection, it uses sendfile(2) so the bytes are copied directly
+// from the page cache to the socket buffer in kernel space, never entering
+// a Go-managed buffer; any other writer falls back to a bounded io.Copy.
+func sendRange(w io.Writer, f *os.File, offset, length int64) (int64, error) {
+	tcpConn, ok := w.(*net.TCPConn)
+	if !ok {
+		return io.Copy(w, io.NewSectionReader(f, offset, length))
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	off := offset
+	remaining := length
+	var written int64
+	var sendErr error
+
+	writeErr := rawConn.Write(func(fd uintptr) bool {
+		for remaining > 0 {
+			n, err := unix.Sendfile(int(fd), int(f.Fd()), &off, int(remaining))
+			if n > 0 {
+				written += int64(n)
+				remaining -= int64(n)
+			}
+			if err == unix.EAGAIN {
+				// Socket buffer is full; ask the runtime to wait for
+				// writability and call us back.
+				return false
+			}
+			if err != nil {
+				sendErr = err
+				return true
+			}
+			if n == 0 {
+				break
+			}
+		}
+		return true
+	})
+	if writeErr != nil {
+		return written, writeErr
+	}
+	return written, sendErr
+}
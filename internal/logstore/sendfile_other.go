@@ -0,0 +1,14 @@
+//go:build !linux
+
+package logstore
+
+import (
+	"io"
+	"os"
+)
+
+// sendRange falls back to a plain, bounded copy on platforms without
+// sendfile(2) support.
+func sendRange(w io.Writer, f *os.File, offset, length int64) (int64, error) {
+	return io.Copy(w, io.NewSectionReader(f, offset, length))
+}
@@ -0,0 +1,61 @@
+package offsets
+
+import (
+	"kafka-clone/internal/logstore"
+	"kafka-clone/internal/topics"
+)
+
+// partitionLog adapts a logstore.Partition (reached through topics.Registry
+// so it shares the normal segment/index machinery) to the Log interface a
+// Store commits through.
+type partitionLog struct {
+	registry  *topics.Registry
+	topic     string
+	partition int32
+}
+
+// NewConsumerOffsetsLog ensures the internal __consumer_offsets topic
+// exists and returns a Log backed by its single partition. A real
+// deployment would hash each group ID across many partitions the way
+// Kafka does; a single partition is enough for one broker to coordinate
+// every group it owns. The topic is created with cleanup.policy=compact,
+// so it only grows with the number of distinct (group, topic, partition)
+// keys ever committed, not the number of commits.
+func NewConsumerOffsetsLog(registry *topics.Registry) (Log, error) {
+	if _, err := registry.GetTopic(ConsumerOffsetsTopic); err != nil {
+		cfg := topics.DefaultConfig()
+		cfg.CleanupPolicy = logstore.CleanupCompact
+		if err := registry.CreateTopic(ConsumerOffsetsTopic, 1, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &partitionLog{registry: registry, topic: ConsumerOffsetsTopic, partition: 0}, nil
+}
+
+func (p *partitionLog) Append(key, payload []byte) (int64, error) {
+	part, err := p.registry.GetPartition(p.topic, p.partition)
+	if err != nil {
+		return 0, err
+	}
+	return part.Append(key, payload)
+}
+
+func (p *partitionLog) Read(offset int64) ([]byte, error) {
+	part, err := p.registry.GetPartition(p.topic, p.partition)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := part.Read(offset)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Payload, nil
+}
+
+func (p *partitionLog) NextOffset() int64 {
+	part, err := p.registry.GetPartition(p.topic, p.partition)
+	if err != nil {
+		return 0
+	}
+	return part.NextOffset()
+}
@@ -0,0 +1,183 @@
+// Package offsets is the durable store consumer-group offset commits are
+// persisted to, backed by the compacted __consumer_offsets internal topic
+// (see NewConsumerOffsetsLog). It lives on its own, independent of
+// internal/groups, so the same (group, topic, partition) -> committed
+// offset store can back transactional produce/consume later without the
+// group coordinator being in the way.
+package offsets
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConsumerOffsetsTopic is the internal compacted topic committed offsets
+// are persisted to, named after Kafka's own __consumer_offsets.
+const ConsumerOffsetsTopic = "__consumer_offsets"
+
+// Log is the durable append-only log a Store commits to. It is satisfied
+// by a single partition of the internal __consumer_offsets topic; the
+// caller is responsible for creating that topic up front (see
+// NewConsumerOffsetsLog).
+type Log interface {
+	Append(key, payload []byte) (int64, error)
+	Read(offset int64) (payload []byte, err error)
+	NextOffset() int64
+}
+
+// Committed is the value side of a (group, topic, partition) commit.
+type Committed struct {
+	Offset   int64
+	Metadata string
+	// CommitTimestamp is when the broker accepted the commit (Unix
+	// millis), the same as Kafka's own __consumer_offsets records use to
+	// expire commits for groups that go permanently idle.
+	CommitTimestamp int64
+}
+
+// Store layers a (group, topic, partition) -> Committed lookup on top of a
+// Log. Every commit is appended as a new record keyed by key(group, topic,
+// partition), a length-prefixed encoding of the three fields; the latest
+// record per key wins. This mirrors
+// how Kafka itself keeps __consumer_offsets as a regular, compacted log
+// under the hood: NewConsumerOffsetsLog creates the topic with
+// cleanup.policy=compact, so the logstore compactor bounds its size over
+// time. Store still rebuilds its index by replaying the whole log once at
+// startup, since compaction only runs periodically.
+type Store struct {
+	log   Log
+	mutex sync.Mutex
+	index map[string]Committed
+}
+
+// New wraps log in a Store, replaying its full history to rebuild the
+// (group, topic, partition) -> Committed index.
+func New(log Log) *Store {
+	s := &Store{
+		log:   log,
+		index: make(map[string]Committed),
+	}
+	s.replay()
+	return s
+}
+
+// replay rebuilds the index by reading every offset in the log from 0 up
+// to NextOffset. Because the log is compacted (see NewConsumerOffsetsLog),
+// most of those offsets were rewritten away the first time compaction ran
+// over them - Log.Read returns an error for any offset that no longer has
+// a record, the same as it would for genuine corruption. Both cases must
+// be treated the same way here: skip that one offset and keep replaying,
+// since aborting on the first gap - which compaction guarantees will
+// exist - would stop the rebuild partway through and silently drop every
+// commit after it.
+func (s *Store) replay() {
+	for offset := int64(0); offset < s.log.NextOffset(); offset++ {
+		payload, err := s.log.Read(offset)
+		if err != nil {
+			continue
+		}
+		group, topic, partition, committed, err := decodeRecord(payload)
+		if err == nil {
+			s.index[key(group, topic, partition)] = committed
+		}
+	}
+}
+
+// Commit persists offset/metadata for (group, topic, partition), stamping
+// it with the current time as its commit timestamp.
+func (s *Store) Commit(group, topic string, partition int32, offset int64, metadata string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	committed := Committed{Offset: offset, Metadata: metadata, CommitTimestamp: time.Now().UnixMilli()}
+	payload := encodeRecord(group, topic, partition, committed)
+	if _, err := s.log.Append([]byte(key(group, topic, partition)), payload); err != nil {
+		return fmt.Errorf("commit offset for group %s: %w", group, err)
+	}
+	s.index[key(group, topic, partition)] = committed
+	return nil
+}
+
+// Fetch returns the last committed offset/metadata for (group, topic,
+// partition), or Offset -1 if nothing has ever been committed.
+func (s *Store) Fetch(group, topic string, partition int32) (Committed, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	committed, ok := s.index[key(group, topic, partition)]
+	if !ok {
+		return Committed{Offset: -1}, nil
+	}
+	return committed, nil
+}
+
+// key must be collision-free across (group, topic) boundaries: group
+// "team" + topic "service:orders" and group "team:service" + topic
+// "orders" must never produce the same key for the same partition. A
+// plain "group:topic:partition" format doesn't hold that property, since
+// ":" can appear inside group or topic names - length-prefixing each
+// field first (the same appendLenPrefixed scheme the on-disk record body
+// already uses) fixes that, because a field's encoded length can never be
+// mistaken for part of its own content.
+func key(group, topic string, partition int32) string {
+	buf := appendLenPrefixed(nil, []byte(group))
+	buf = appendLenPrefixed(buf, []byte(topic))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(partition))
+	return string(buf)
+}
+
+// encodeRecord serializes a commit as
+// [groupLen][group][topicLen][topic][partition][offset][commitTimestamp][metaLen][metadata].
+func encodeRecord(group, topic string, partition int32, committed Committed) []byte {
+	buf := make([]byte, 0, len(group)+len(topic)+len(committed.Metadata)+32)
+	buf = appendLenPrefixed(buf, []byte(group))
+	buf = appendLenPrefixed(buf, []byte(topic))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(partition))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(committed.Offset))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(committed.CommitTimestamp))
+	buf = appendLenPrefixed(buf, []byte(committed.Metadata))
+	return buf
+}
+
+func decodeRecord(payload []byte) (group, topic string, partition int32, committed Committed, err error) {
+	var rest []byte
+
+	group, rest, err = readLenPrefixed(payload)
+	if err != nil {
+		return
+	}
+	topic, rest, err = readLenPrefixed(rest)
+	if err != nil {
+		return
+	}
+	if len(rest) < 20 {
+		err = fmt.Errorf("offset record too short")
+		return
+	}
+	partition = int32(binary.BigEndian.Uint32(rest[:4]))
+	committed.Offset = int64(binary.BigEndian.Uint64(rest[4:12]))
+	committed.CommitTimestamp = int64(binary.BigEndian.Uint64(rest[12:20]))
+	rest = rest[20:]
+
+	committed.Metadata, _, err = readLenPrefixed(rest)
+	return
+}
+
+func appendLenPrefixed(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+func readLenPrefixed(buf []byte) (string, []byte, error) {
+	if len(buf) < 4 {
+		return "", nil, fmt.Errorf("truncated length prefix")
+	}
+	n := binary.BigEndian.Uint32(buf[:4])
+	buf = buf[4:]
+	if uint32(len(buf)) < n {
+		return "", nil, fmt.Errorf("truncated field")
+	}
+	return string(buf[:n]), buf[n:], nil
+}
@@ -0,0 +1,100 @@
+package offsets
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeLog is an in-memory Log that can simulate compaction gaps by having
+// Read return an error for chosen offsets, the same way Segment.Read does
+// for an offset compaction rewrote away.
+type fakeLog struct {
+	records []fakeRecord
+	gaps    map[int64]bool
+}
+
+type fakeRecord struct {
+	key, payload []byte
+}
+
+func (f *fakeLog) Append(key, payload []byte) (int64, error) {
+	offset := int64(len(f.records))
+	f.records = append(f.records, fakeRecord{key: key, payload: payload})
+	return offset, nil
+}
+
+func (f *fakeLog) Read(offset int64) ([]byte, error) {
+	if f.gaps[offset] {
+		return nil, fmt.Errorf("offset %d not found", offset)
+	}
+	if offset < 0 || offset >= int64(len(f.records)) {
+		return nil, fmt.Errorf("offset %d not found", offset)
+	}
+	return f.records[offset].payload, nil
+}
+
+func (f *fakeLog) NextOffset() int64 {
+	return int64(len(f.records))
+}
+
+// TestStoreReplaySkipsCompactionGaps guards against regressing to the
+// aborts-on-first-error version of replay: a gap partway through the log
+// (exactly what compaction leaves behind) must not stop commits after it
+// from being recovered.
+func TestStoreReplaySkipsCompactionGaps(t *testing.T) {
+	log := &fakeLog{gaps: map[int64]bool{}}
+	committed := Committed{Offset: 1, Metadata: "m1", CommitTimestamp: 1}
+	if _, err := log.Append([]byte(key("g", "t", 0)), encodeRecord("g", "t", 0, committed)); err != nil {
+		t.Fatal(err)
+	}
+	log.gaps[0] = true // compaction rewrote this one away
+
+	committed2 := Committed{Offset: 2, Metadata: "m2", CommitTimestamp: 2}
+	if _, err := log.Append([]byte(key("g", "t", 0)), encodeRecord("g", "t", 0, committed2)); err != nil {
+		t.Fatal(err)
+	}
+
+	store := New(log)
+	got, err := store.Fetch("g", "t", 0)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got.Offset != committed2.Offset {
+		t.Fatalf("got offset %d, want %d (gap at offset 0 should not have stopped replay)", got.Offset, committed2.Offset)
+	}
+}
+
+// TestKeyDoesNotAliasAcrossGroupTopicBoundary guards against the
+// "group:topic:partition" format, where group "team" + topic
+// "service:orders" collides with group "team:service" + topic "orders".
+func TestKeyDoesNotAliasAcrossGroupTopicBoundary(t *testing.T) {
+	a := key("team", "service:orders", 0)
+	b := key("team:service", "orders", 0)
+	if a == b {
+		t.Fatalf("key(%q, %q, 0) == key(%q, %q, 0): %q", "team", "service:orders", "team:service", "orders", a)
+	}
+}
+
+func TestStoreCommitAndFetch(t *testing.T) {
+	log := &fakeLog{gaps: map[int64]bool{}}
+	store := New(log)
+
+	if err := store.Commit("g", "t", 0, 5, "meta"); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	got, err := store.Fetch("g", "t", 0)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got.Offset != 5 || got.Metadata != "meta" {
+		t.Fatalf("got %+v, want offset 5 meta %q", got, "meta")
+	}
+
+	missing, err := store.Fetch("g", "t", 1)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if missing.Offset != -1 {
+		t.Fatalf("got offset %d for uncommitted partition, want -1", missing.Offset)
+	}
+}
@@ -0,0 +1,84 @@
+package producers
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NoProducerID marks a Produce/ProduceBatch call as non-idempotent, the
+// same sentinel Kafka itself uses (NO_PRODUCER_ID = -1) for clients that
+// haven't been assigned a producer id.
+const NoProducerID int64 = -1
+
+// accepted is the last (sequence range, offset) an idempotent producer had
+// appended for one partition.
+type accepted struct {
+	baseSequence int32
+	count        int32
+	offset       int64
+}
+
+// idempotentState deduplicates retried appends from an idempotent
+// producer. Each (producerID, topic, partition) remembers the sequence
+// range and offset of the last append it accepted, so a retry of the
+// exact same request (e.g. after a dropped ack) is recognized and
+// answered with the original offset instead of being appended a second
+// time. A single record counts as a range of length 1; a batch counts as
+// a range the width of the batch, so both Produce and ProduceBatch share
+// one mechanism.
+//
+// The map has no eviction: every (producerID, topic, partition) a broker
+// has ever accepted an idempotent append for stays resident for the life
+// of the process, the same tradeoff Kafka itself only avoids by expiring
+// producer ids after producer.id.expiration.ms of inactivity - a feature
+// this broker doesn't implement yet.
+type idempotentState struct {
+	mutex sync.Mutex
+	last  map[string]accepted
+}
+
+func newIdempotentState() *idempotentState {
+	return &idempotentState{last: make(map[string]accepted)}
+}
+
+// dedupeAppend runs appendFn under the same lock that checks (baseSequence,
+// count) against the last accepted range for (producerID, topic,
+// partition), so a duplicate retry and its original can never both pass
+// the check and both append: checking and recording happen as one atomic
+// step instead of two separate locked sections with the append
+// in between. If (baseSequence, count) exactly matches the last accepted
+// append, appendFn is skipped and the original offset is returned. Any
+// other out-of-order sequence number - most likely a producer that was
+// restarted and lost its sequence counter - is rejected so the issue
+// surfaces instead of silently corrupting offsets.
+func (s *idempotentState) dedupeAppend(producerID int64, topic string, partition int32, baseSequence, count int32, appendFn func() (int64, error)) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := idempotentKey(producerID, topic, partition)
+	prev, ok := s.last[k]
+	if !ok {
+		if baseSequence != 0 {
+			return 0, fmt.Errorf("out of order sequence for producer %d on %s/%d: got %d, expected 0", producerID, topic, partition, baseSequence)
+		}
+	} else {
+		expected := prev.baseSequence + prev.count
+		switch {
+		case baseSequence == prev.baseSequence && count == prev.count:
+			return prev.offset, nil
+		case baseSequence != expected:
+			return 0, fmt.Errorf("out of order sequence for producer %d on %s/%d: got %d, expected %d", producerID, topic, partition, baseSequence, expected)
+		}
+	}
+
+	offset, err := appendFn()
+	if err != nil {
+		return 0, err
+	}
+	s.last[k] = accepted{baseSequence: baseSequence, count: count, offset: offset}
+	return offset, nil
+}
+
+func idempotentKey(producerID int64, topic string, partition int32) string {
+	return fmt.Sprintf("%d:%s:%d", producerID, topic, partition)
+}
@@ -1,29 +1,121 @@
 package producers
 
 import (
+	"fmt"
+	"kafka-clone/internal/compression"
+	"kafka-clone/internal/logstore"
 	"kafka-clone/internal/topics"
 )
 
+// Acks mirrors Kafka's producer acks setting.
+const (
+	AcksNone   = 0
+	AcksLeader = 1
+	AcksAll    = -1
+)
+
 type Producer struct {
-	registry *topics.Registry
+	registry   *topics.Registry
+	idempotent *idempotentState
 }
 
 func NewProducer(registry *topics.Registry) *Producer {
 	return &Producer{
-		registry: registry,
+		registry:   registry,
+		idempotent: newIdempotentState(),
 	}
 }
 
-func (p *Producer) Produce(topic string, partition int32, payload []byte) (int32, int64, error) {
-	part, err := p.registry.GetPartition(topic, partition)
+// Produce appends payload (keyed by key, which may be nil for topics that
+// don't use log compaction) to a partition. When acks is AcksAll, the write
+// is rejected unless the partition currently has at least
+// min.insync.replicas replicas in its ISR, the same guarantee Kafka gives
+// acks=all producers; for unreplicated topics (no internal/cluster
+// attached) the ISR is simply never populated, so acks=all always fails
+// fast rather than silently behaving like acks=1.
+//
+// producerID/sequence make the append idempotent: pass NoProducerID to
+// skip the check entirely, or a producer id plus a sequence number that
+// increments by one per record sent by that producer to this partition. A
+// retry that resends the same sequence number (e.g. after the original
+// ack was lost) is deduped and returns the offset of the original append
+// instead of writing a second copy.
+func (p *Producer) Produce(topic string, partition int32, key, payload []byte, acks int32, producerID int64, sequence int32) (int32, int64, error) {
+	if acks == AcksAll {
+		if err := p.checkInSyncReplicas(topic, partition); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	appendOne := func() (int64, error) {
+		part, err := p.registry.GetPartition(topic, partition)
+		if err != nil {
+			return 0, err
+		}
+		return part.Append(key, payload)
+	}
+
+	if producerID == NoProducerID {
+		offset, err := appendOne()
+		if err != nil {
+			return 0, 0, err
+		}
+		return partition, offset, nil
+	}
+
+	offset, err := p.idempotent.dedupeAppend(producerID, topic, partition, sequence, 1, appendOne)
 	if err != nil {
 		return 0, 0, err
 	}
+	return partition, offset, nil
+}
+
+// ProduceBatch appends records to a partition as a single codec-compressed
+// batch instead of one write per record, and returns the partition and the
+// base offset assigned to the batch. acks
+// follows the same acks=all ISR check as Produce, and producerID/
+// baseSequence follow the same idempotent-append rule as Produce, except
+// the batch consumes len(records) sequence numbers starting at
+// baseSequence instead of just one.
+func (p *Producer) ProduceBatch(topic string, partition int32, records []logstore.LogEntry, codec compression.Codec, acks int32, producerID int64, baseSequence int32) (int32, int64, error) {
+	if acks == AcksAll {
+		if err := p.checkInSyncReplicas(topic, partition); err != nil {
+			return 0, 0, err
+		}
+	}
 
-	offset, err := part.Append(payload)
+	appendBatch := func() (int64, error) {
+		return p.registry.AppendBatch(topic, partition, codec, records)
+	}
+
+	if producerID == NoProducerID {
+		baseOffset, err := appendBatch()
+		if err != nil {
+			return 0, 0, err
+		}
+		return partition, baseOffset, nil
+	}
+
+	baseOffset, err := p.idempotent.dedupeAppend(producerID, topic, partition, baseSequence, int32(len(records)), appendBatch)
 	if err != nil {
 		return 0, 0, err
 	}
+	return partition, baseOffset, nil
+}
 
-	return partition, offset, nil
+func (p *Producer) checkInSyncReplicas(topic string, partition int32) error {
+	min, err := p.registry.MinInSyncReplicas(topic)
+	if err != nil {
+		return err
+	}
+
+	isr, err := p.registry.ISR(topic, partition)
+	if err != nil {
+		return err
+	}
+
+	if int32(len(isr)) < min {
+		return fmt.Errorf("not enough in-sync replicas for %s/%d: have %d, need %d", topic, partition, len(isr), min)
+	}
+	return nil
 }